@@ -4,6 +4,7 @@ import (
 	"fmt"
 
 	"github.com/filecoin-project/filecoin-chain-archiver/pkg/config"
+	"github.com/filecoin-project/filecoin-chain-archiver/pkg/export"
 	"github.com/urfave/cli/v2"
 )
 
@@ -17,8 +18,9 @@ var cmdDefaultConfig = &cli.Command{
 
 		cfg := config.DefaultExportWorkerConfig()
 		cfg.Nodes = append(cfg.Nodes, config.Node{
-			Address:   "/ip4/127.0.0.1/1234",
-			TokenPath: "/path/to/token",
+			Address:         "/ip4/127.0.0.1/1234",
+			TokenPath:       "/path/to/token",
+			RestartStrategy: export.RestartStrategySupervisor,
 		})
 		icfg = cfg
 
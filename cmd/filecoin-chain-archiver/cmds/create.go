@@ -1,13 +1,19 @@
 package cmds
 
 import (
+	"bytes"
 	"context"
 	"crypto/sha256"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"math/rand"
+	"net"
+	"net/http"
 	"net/url"
+	"path"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
@@ -17,7 +23,11 @@ import (
 	"github.com/filecoin-project/filecoin-chain-archiver/pkg/config"
 	"github.com/filecoin-project/filecoin-chain-archiver/pkg/consensus"
 	"github.com/filecoin-project/filecoin-chain-archiver/pkg/export"
+	"github.com/filecoin-project/filecoin-chain-archiver/pkg/index"
+	"github.com/filecoin-project/filecoin-chain-archiver/pkg/job"
+	jobservice "github.com/filecoin-project/filecoin-chain-archiver/pkg/job/service"
 	"github.com/filecoin-project/filecoin-chain-archiver/pkg/nodelocker/client"
+	"github.com/filecoin-project/filecoin-chain-archiver/pkg/tlsutil"
 	"github.com/filecoin-project/go-state-types/abi"
 	"github.com/klauspost/compress/zstd"
 	"github.com/minio/minio-go/v7"
@@ -28,8 +38,78 @@ import (
 	"github.com/filecoin-project/lotus/api"
 )
 
-func Compress(in io.Reader, out io.Writer) error {
-	enc, err := zstd.NewWriter(out)
+// maxStreamConcurrency is the number of goroutines which compress a single zstd frame
+const maxStreamConcurrency = 2
+
+// compressionOptions returns the encoder options of cfg, checking they are accepted by the encoder.
+func compressionOptions(cfg config.CompressionConfig) ([]zstd.EOption, error) {
+	var opts []zstd.EOption
+
+	if cfg.Level != "" {
+		level, err := parseCompressionLevel(cfg.Level)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, zstd.WithEncoderLevel(level))
+	}
+
+	// a single frame is compressed one block at a time while the previous block is written, so more goroutines are
+	// only used by seekable frames, which are compressed independently
+	if cfg.Concurrency > maxStreamConcurrency && cfg.SeekableFrameSize == 0 {
+		return nil, fmt.Errorf("compression concurrency above %d requires a seekable frame size, a single frame uses at most %d goroutines", maxStreamConcurrency, maxStreamConcurrency)
+	}
+
+	if cfg.Concurrency != 0 {
+		opts = append(opts, zstd.WithEncoderConcurrency(cfg.Concurrency))
+	}
+
+	if cfg.WindowSize != 0 {
+		opts = append(opts, zstd.WithWindowSize(cfg.WindowSize))
+	}
+
+	enc, err := zstd.NewWriter(nil, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("invalid compression options: %w", err)
+	}
+	enc.Close()
+
+	return opts, nil
+}
+
+// parseCompressionLevel parses a zstd level from 1 to 22, or the name of an encoder level.
+func parseCompressionLevel(s string) (zstd.EncoderLevel, error) {
+	if n, err := strconv.Atoi(s); err == nil {
+		if n < 1 || n > 22 {
+			return 0, fmt.Errorf("compression level %d must be between 1 and 22", n)
+		}
+		return zstd.EncoderLevelFromZstd(n), nil
+	}
+
+	ok, level := zstd.EncoderLevelFromString(s)
+	if !ok {
+		return 0, fmt.Errorf("unknown compression level %q, expected 1-22, fastest, default, better or best", s)
+	}
+
+	return level, nil
+}
+
+// CompressSeekable compresses in as independent frames of frameSize uncompressed bytes followed by a seek table,
+// compressing up to concurrency frames at once.
+func CompressSeekable(in io.Reader, out io.Writer, frameSize, concurrency int, opts ...zstd.EOption) error {
+	enc, err := export.NewSeekableWriter(out, frameSize, concurrency, opts...)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(enc, in)
+	if err != nil {
+		enc.Close()
+		return err
+	}
+	return enc.Close()
+}
+
+func Compress(in io.Reader, out io.Writer, opts ...zstd.EOption) error {
+	enc, err := zstd.NewWriter(out, opts...)
 	if err != nil {
 		return err
 	}
@@ -66,6 +146,24 @@ func (m *multi) Close() error {
 	return first
 }
 
+// CloseWithError closes the writers, passing err to those which support it, such as io.PipeWriter.
+func (m *multi) CloseWithError(err error) error {
+	var first error
+	for _, c := range m.cs {
+		var cerr error
+		if ec, ok := c.(interface{ CloseWithError(error) error }); ok {
+			cerr = ec.CloseWithError(err)
+		} else {
+			cerr = c.Close()
+		}
+
+		if cerr != nil && first == nil {
+			first = cerr
+		}
+	}
+	return first
+}
+
 type snapshotInfo struct {
 	digest         string
 	size           int64
@@ -97,7 +195,7 @@ var cmdCreate = &cli.Command{
 
 		An exact epoch height can also be supplied with the 'height' flag.
 	`),
-	Flags: []cli.Flag{
+	Flags: joinFlags([]cli.Flag{
 		&cli.StringFlag{
 			Name:    "name-prefix",
 			Usage:   "add a prefix to the snapshot name",
@@ -183,10 +281,77 @@ var cmdCreate = &cli.Command{
 			EnvVars: []string{"FCA_CREATE_PROGRESS_UPDATE"},
 			Value:   60 * time.Second,
 		},
-	},
-	Action: func(cctx *cli.Context) error {
+		&cli.StringFlag{
+			Name:    "status-listen",
+			Usage:   "host and port to serve job status, metrics and health checks on (disabled when empty)",
+			EnvVars: []string{"FCA_CREATE_STATUS_LISTEN"},
+		},
+		&cli.StringFlag{
+			Name:    "pushgateway",
+			Usage:   "URL of a prometheus pushgateway to push job metrics to when the job finishes",
+			EnvVars: []string{"FCA_CREATE_PUSHGATEWAY"},
+		},
+		&cli.StringFlag{
+			Name:    "pushgateway-job",
+			Usage:   "job name used when pushing metrics",
+			EnvVars: []string{"FCA_CREATE_PUSHGATEWAY_JOB"},
+			Value:   "filecoin-chain-archiver",
+		},
+		&cli.DurationFlag{
+			Name:    "export-stall-timeout",
+			Usage:   "abort the export when no data is received from the node for this long (0 to disable)",
+			EnvVars: []string{"FCA_CREATE_EXPORT_STALL_TIMEOUT"},
+			Value:   10 * time.Minute,
+		},
+		&cli.DurationFlag{
+			Name:    "export-timeout",
+			Usage:   "abort the export when it has not finished within this long, including the node restart (0 to disable)",
+			EnvVars: []string{"FCA_CREATE_EXPORT_TIMEOUT"},
+			Value:   0,
+		},
+		&cli.StringFlag{
+			Name:    "index-operator-api",
+			Usage:   "api info of the index resolver operator api to refresh after publishing, eg: TOKEN:http://localhost:5201",
+			EnvVars: []string{"FCA_CREATE_INDEX_OPERATOR_API"},
+		},
+		&cli.StringFlag{
+			Name:    "compression-level",
+			Usage:   "zstd level from 1 to 22, or fastest, default, better or best (overrides Compression.Level)",
+			EnvVars: []string{"FCA_CREATE_COMPRESSION_LEVEL"},
+		},
+		&cli.IntFlag{
+			Name:    "compression-concurrency",
+			Usage:   "goroutines used by the encoder, 1 disables async compression, above 2 requires --seekable-frame-size (overrides Compression.Concurrency)",
+			EnvVars: []string{"FCA_CREATE_COMPRESSION_CONCURRENCY"},
+		},
+		&cli.IntFlag{
+			Name:    "compression-window-size",
+			Usage:   "encoder window in bytes, a power of two between 1KiB and 512MiB (overrides Compression.WindowSize)",
+			EnvVars: []string{"FCA_CREATE_COMPRESSION_WINDOW_SIZE"},
+		},
+		&cli.IntFlag{
+			Name:    "seekable-frame-size",
+			Usage:   "write seekable zstd with frames of this many uncompressed bytes, 0 disables (overrides Compression.SeekableFrameSize)",
+			EnvVars: []string{"FCA_CREATE_SEEKABLE_FRAME_SIZE"},
+		},
+	}, clientTLSFlags("nodelocker-", "FCA_CREATE_NODELOCKER"), clientTLSFlags("index-operator-", "FCA_CREATE_INDEX_OPERATOR")),
+	Action: func(cctx *cli.Context) (err error) {
 		ctx := context.Background()
 
+		jb := job.NewJob()
+		defer func() {
+			jb.Finish(err)
+
+			if cctx.String("pushgateway") == "" {
+				return
+			}
+
+			grouping := map[string]string{"instance": cctx.String("name-prefix"), "result": job.Result(err)}
+			if err := job.Push(ctx, cctx.String("pushgateway"), cctx.String("pushgateway-job"), grouping); err != nil {
+				logger.Errorw("failed to push metrics", "pushgateway", cctx.String("pushgateway"), "err", err)
+			}
+		}()
+
 		flagBucketEndpoint := cctx.String("bucket-endpoint")
 		flagBucketAccessKey := cctx.String("access-key")
 		flagBucketSecretKey := cctx.String("secret-key")
@@ -202,6 +367,9 @@ var cmdCreate = &cli.Command{
 		flagHeight := cctx.Int("height")
 		flagAfter := cctx.Int("after")
 		flagStaterootCount := cctx.Int("stateroot-count")
+		flagExportStallTimeout := cctx.Duration("export-stall-timeout")
+		flagExportTimeout := cctx.Duration("export-timeout")
+		flagStatusListen := cctx.String("status-listen")
 
 		u, err := url.Parse(flagBucketEndpoint)
 		if err != nil {
@@ -215,14 +383,54 @@ var cmdCreate = &cli.Command{
 
 		cfg := icfg.(*config.ExportWorkerConfig)
 
+		if cctx.IsSet("compression-level") {
+			cfg.Compression.Level = cctx.String("compression-level")
+		}
+		if cctx.IsSet("compression-concurrency") {
+			cfg.Compression.Concurrency = cctx.Int("compression-concurrency")
+		}
+		if cctx.IsSet("compression-window-size") {
+			cfg.Compression.WindowSize = cctx.Int("compression-window-size")
+		}
+		if cctx.IsSet("seekable-frame-size") {
+			cfg.Compression.SeekableFrameSize = cctx.Int("seekable-frame-size")
+		}
+
+		compressOpts, err := compressionOptions(cfg.Compression)
+		if err != nil {
+			return err
+		}
+		logger.Infow("compression", "level", cfg.Compression.Level, "concurrency", cfg.Compression.Concurrency, "window_size", cfg.Compression.WindowSize, "seekable_frame_size", cfg.Compression.SeekableFrameSize)
+
+		compress := func(in io.Reader, out io.Writer) error {
+			return Compress(in, out, compressOpts...)
+		}
+		if cfg.Compression.SeekableFrameSize != 0 {
+			frameSize := cfg.Compression.SeekableFrameSize
+			concurrency := cfg.Compression.Concurrency
+			if frameSize < 0 || frameSize > export.MaxSeekableFrameSize {
+				return fmt.Errorf("seekable frame size must be between 0 and %d", export.MaxSeekableFrameSize)
+			}
+
+			compress = func(in io.Reader, out io.Writer) error {
+				return CompressSeekable(in, out, frameSize, concurrency, compressOpts...)
+			}
+		}
+
 		addrs, err := NodeMultiaddrs(cfg)
 		if err != nil {
 			return err
 		}
 
 		var nodes []api.FullNode
+		restarts := make(map[api.FullNode]export.RestartStrategy)
+
+		for i, addr := range addrs {
+			restart, err := export.NewRestartStrategy(cfg.Nodes[i].RestartStrategy, cfg.Nodes[i].RestartCommand)
+			if err != nil {
+				return xerrors.Errorf("node %s: %w", cfg.Nodes[i].Address, err)
+			}
 
-		for _, addr := range addrs {
 			node, closer, err := CreateLotusClient(ctx, addr)
 			if err != nil {
 				if errors.Is(err, syscall.ECONNREFUSED) {
@@ -237,6 +445,7 @@ var cmdCreate = &cli.Command{
 			defer closer()
 
 			nodes = append(nodes, node)
+			restarts[node] = restart
 		}
 
 		if len(nodes) == 0 {
@@ -280,6 +489,17 @@ var cmdCreate = &cli.Command{
 
 		// Snapshots started
 		logger.Infow("snapshot job started", "snapshot_height", height, "current_height", expected, "confidence_height", confidenceHeight, "run_at", t)
+
+		jb.SetHeight(height)
+		if flagStatusListen != "" {
+			shutdown, err := runJobStatusService(ctx, flagStatusListen, jb)
+			if err != nil {
+				return err
+			}
+
+			defer shutdown()
+		}
+
 		time.Sleep(time.Until(t))
 		bt := time.Now()
 
@@ -288,7 +508,7 @@ var cmdCreate = &cli.Command{
 			return err
 		}
 
-		nl, err := client.NewNodeLocker(ctx, flagNodeLockerAPI)
+		nl, err := client.NewNodeLocker(ctx, flagNodeLockerAPI, client.WithTLS(clientTLS(cctx, "nodelocker-")))
 		if err != nil {
 			return err
 		}
@@ -324,14 +544,29 @@ var cmdCreate = &cli.Command{
 			return xerrors.Errorf("failed to aquire lock")
 		}
 
+		jb.SetPeer(peerID, lock)
+
 		rc, wc := io.Pipe()
 
 		mw := MultiWriteCloser(wc)
 
-		e := export.NewExport(node, tsk, abi.ChainEpoch(flagStaterootCount), true, mw)
-		errCh := make(chan error)
+		watchdog := export.Watchdog{
+			StallTimeout: flagExportStallTimeout,
+			Deadline:     flagExportTimeout,
+		}
+
+		e := export.NewExport(node, tsk, abi.ChainEpoch(flagStaterootCount), true, mw, restarts[node], watchdog)
+		jb.SetExport(e)
+		errCh := make(chan error, 1)
 		go func() {
-			errCh <- e.Export(ctx)
+			err := e.Export(ctx)
+			switch {
+			case errors.Is(err, export.ErrExportStalled):
+				logger.Errorw("export aborted by watchdog", "reason", "stalled", "peer", peerID, "err", err)
+			case errors.Is(err, export.ErrExportDeadline):
+				logger.Errorw("export aborted by watchdog", "reason", "deadline", "peer", peerID, "err", err)
+			}
+			errCh <- err
 		}()
 
 		go func() {
@@ -360,16 +595,18 @@ var cmdCreate = &cli.Command{
 			for {
 				select {
 				case <-time.After(flagProgressUpdate):
-					size, done := e.Progress()
-					if size == 0 {
-						continue
+					status := e.Status()
+					if status.Phase.Final() {
+						return
 					}
 
-					if done {
-						return
+					if status.Bytes == 0 {
+						logger.Infow("update", "phase", status.Phase, "phase_elapsed", time.Since(status.PhaseStarted).Round(time.Second))
+						continue
 					}
 
-					logger.Infow("update", "total", size, "speed", (size-lastSize)/int(flagProgressUpdate/time.Second))
+					size := status.Bytes
+					logger.Infow("update", "phase", status.Phase, "total", size, "speed", (size-lastSize)/int(flagProgressUpdate/time.Second))
 					lastSize = size
 				}
 			}
@@ -411,6 +648,12 @@ var cmdCreate = &cli.Command{
 				return err
 			}
 
+			if size, err := previousSnapshotSize(ctx, minioClient, flagBucket, flagNamePrefix); err != nil {
+				logger.Warnw("failed to find previous snapshot size", "err", err)
+			} else {
+				jb.SetPreviousSize(size)
+			}
+
 			t := export.TimeAtHeight(gtp, height, 30*time.Second)
 
 			name := fmt.Sprintf("%d_%s", height, t.Format("2006_01_02T15_04_05Z"))
@@ -422,7 +665,7 @@ var cmdCreate = &cli.Command{
 
 			g.Go(func() error {
 				var err error
-				siCompressed, err = runUploadCompressed(ctxGroup, minioClient, flagBucket, flagNamePrefix, flagRetrievalEndpointPrefix, name, peerID, bt, rc)
+				siCompressed, err = runUploadCompressed(ctxGroup, minioClient, flagBucket, flagNamePrefix, flagRetrievalEndpointPrefix, name, peerID, bt, rc, jb, compress)
 				return err
 			})
 			if err := g.Wait(); err != nil {
@@ -449,14 +692,36 @@ var cmdCreate = &cli.Command{
 				logger.Errorw("failed to write sha256sum", "object", fmt.Sprintf("%s%s.sha256sum", flagNamePrefix, name), "err", err)
 			}
 
+			manifest, err := json.Marshal(index.Snapshot{
+				Name:      name,
+				Key:       fmt.Sprintf("%s%s", flagNamePrefix, siCompressed.filename),
+				Height:    int64(height),
+				Timestamp: t,
+				Size:      siCompressed.size,
+				Digest:    siCompressed.digest,
+				URL:       siCompressed.latestLocation,
+			})
+			if err != nil {
+				return err
+			}
+
+			_, err = minioClient.PutObject(ctx, flagBucket, fmt.Sprintf("%s%s.json", flagNamePrefix, name), bytes.NewReader(manifest), int64(len(manifest)), minio.PutObjectOptions{
+				ContentType: "application/json",
+			})
+			if err != nil {
+				logger.Errorw("failed to write manifest", "object", fmt.Sprintf("%s%s.json", flagNamePrefix, name), "err", err)
+			}
+
 			for _, x := range sis {
 				info, err := minioClient.PutObject(ctx, flagBucket, fmt.Sprintf("%s%s", flagNamePrefix, x.latestIndex), strings.NewReader(x.latestLocation), -1, minio.PutObjectOptions{
 					ContentType: "text/plain",
 				})
 				if err != nil {
-					return fmt.Errorf("failed to write latest", "object", fmt.Sprintf("%slatest", flagNamePrefix), "err", err)
+					return fmt.Errorf("failed to write latest (%s): %w", fmt.Sprintf("%s%s", flagNamePrefix, x.latestIndex), err)
 				}
 
+				job.Published(flagNamePrefix, height, t)
+
 				logger.Infow("latest upload",
 					"bucket", info.Bucket,
 					"key", info.Key,
@@ -467,6 +732,13 @@ var cmdCreate = &cli.Command{
 					"expiration", info.Expiration,
 					"expiration_rule_id", info.ExpirationRuleID,
 				)
+
+				if flagIndexOperatorAPI := cctx.String("index-operator-api"); flagIndexOperatorAPI != "" {
+					key := fmt.Sprintf("%s%s", flagNamePrefix, x.latestIndex)
+					if err := refreshIndex(ctx, flagIndexOperatorAPI, clientTLS(cctx, "index-operator-"), key); err != nil {
+						logger.Warnw("failed to refresh index resolver", "api", flagIndexOperatorAPI, "key", key, "err", err)
+					}
+				}
 			}
 		}
 
@@ -476,18 +748,19 @@ var cmdCreate = &cli.Command{
 	},
 }
 
-func runUploadCompressed(ctx context.Context, minioClient *minio.Client, flagBucket, flagNamePrefix, flagRetrievalEndpointPrefix, name, peerID string, bt time.Time, source io.Reader) (*snapshotInfo, error) {
+func runUploadCompressed(ctx context.Context, minioClient *minio.Client, flagBucket, flagNamePrefix, flagRetrievalEndpointPrefix, name, peerID string, bt time.Time, source io.Reader, jb *job.Job, compress func(io.Reader, io.Writer) error) (*snapshotInfo, error) {
 
 	r1, w1 := io.Pipe()
 	go func() {
-		Compress(source, w1)
-		w1.Close()
+		// a failed compression fails the upload rather than publishing a truncated object
+		w1.CloseWithError(compress(source, w1))
 	}()
 	h := sha256.New()
-	r := io.TeeReader(r1, h)
+	r := io.TeeReader(r1, io.MultiWriter(h, &compressedCounter{jb}))
 
 	filename := fmt.Sprintf("%s.car.zst", name)
 
+	start := time.Now()
 	info, err := minioClient.PutObject(ctx, flagBucket, fmt.Sprintf("%s%s", flagNamePrefix, filename), r, -1, minio.PutObjectOptions{
 		ContentDisposition: fmt.Sprintf("attachment; filename=\"%s\"", filename),
 		ContentType:        "application/octet-stream",
@@ -496,6 +769,8 @@ func runUploadCompressed(ctx context.Context, minioClient *minio.Client, flagBuc
 		return nil, fmt.Errorf("failed to upload object (%s): %w", fmt.Sprintf("%s%s", flagNamePrefix, filename), err)
 	}
 
+	job.UploadDuration.Observe(time.Since(start).Seconds())
+
 	logger.Infow("compressed snapshot upload",
 		"bucket", info.Bucket,
 		"key", info.Key,
@@ -527,3 +802,97 @@ func runUploadCompressed(ctx context.Context, minioClient *minio.Client, flagBuc
 		latestLocation: latestLocation,
 	}, nil
 }
+
+type compressedCounter struct {
+	jb *job.Job
+}
+
+func (c *compressedCounter) Write(p []byte) (int, error) {
+	c.jb.AddCompressed(len(p))
+	return len(p), nil
+}
+
+// previousSnapshotSize returns the size of the snapshot the latest index currently points to.
+func previousSnapshotSize(ctx context.Context, minioClient *minio.Client, bucket, namePrefix string) (int64, error) {
+	object, err := minioClient.GetObject(ctx, bucket, fmt.Sprintf("%slatest", namePrefix), minio.GetObjectOptions{})
+	if err != nil {
+		return 0, err
+	}
+	defer object.Close()
+
+	data, err := io.ReadAll(object)
+	if err != nil {
+		return 0, err
+	}
+
+	location, err := url.Parse(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0, err
+	}
+
+	info, err := minioClient.StatObject(ctx, bucket, fmt.Sprintf("%s%s", namePrefix, path.Base(location.Path)), minio.StatObjectOptions{})
+	if err != nil {
+		return 0, err
+	}
+
+	return info.Size, nil
+}
+
+// refreshIndex asks the index resolver service to resolve key again, so it serves the new snapshot without waiting
+// for its cache to expire.
+func refreshIndex(ctx context.Context, apiInfo string, tlsCfg tlsutil.ClientConfig, key string) error {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	operator, closer, err := newIndexOperatorClient(ctx, apiInfo, tlsCfg)
+	if err != nil {
+		return err
+	}
+	defer closer()
+
+	value, err := operator.CacheRefresh(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	logger.Infow("index resolver refreshed", "key", key, "value", value)
+
+	return nil
+}
+
+func runJobStatusService(ctx context.Context, listen string, jb *job.Job) (func(), error) {
+	s := jobservice.NewJobStatusService(ctx, jb)
+	if err := s.SetupService(); err != nil {
+		return nil, err
+	}
+
+	svr := &http.Server{
+		Addr:    listen,
+		Handler: s.Router,
+		BaseContext: func(listener net.Listener) context.Context {
+			return context.Background()
+		},
+	}
+
+	go func() {
+		logger.Debugw("job status service running", "listen", listen)
+		err := svr.ListenAndServe()
+		switch err {
+		case nil:
+		case http.ErrServerClosed:
+			logger.Infow("server closed")
+		default:
+			logger.Errorw("error running job status server", "err", err)
+		}
+	}()
+
+	return func() {
+		s.Shutdown()
+
+		ctx, cancel := context.WithTimeout(ctx, svrShutdownTimeout)
+		defer cancel()
+		if err := svr.Shutdown(ctx); err != nil {
+			logger.Errorw("error shutting down job status server", "err", err)
+		}
+	}, nil
+}
@@ -0,0 +1,142 @@
+package cmds
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/filecoin-chain-archiver/pkg/config"
+	"github.com/filecoin-project/filecoin-chain-archiver/pkg/export"
+)
+
+// benchmarkData returns data which compresses roughly like a chain export: random hashes repeated across records,
+// with the rest of each record drawn from a small alphabet.
+func benchmarkData(size int) []byte {
+	rng := rand.New(rand.NewSource(1))
+
+	hashes := make([][]byte, 4096)
+	for i := range hashes {
+		hashes[i] = make([]byte, 32)
+		rng.Read(hashes[i])
+	}
+
+	var buf bytes.Buffer
+	for buf.Len() < size {
+		buf.Write(hashes[rng.Intn(len(hashes))])
+		for i := 0; i < 32; i++ {
+			buf.WriteByte(byte(rng.Intn(16)))
+		}
+	}
+
+	return buf.Bytes()[:size]
+}
+
+func TestCompressionOptions(t *testing.T) {
+	data := benchmarkData(1 << 20)
+
+	for _, cfg := range []config.CompressionConfig{
+		{},
+		{Level: "fastest"},
+		{Level: "19", Concurrency: 1, WindowSize: 1 << 20},
+		{Concurrency: 8, SeekableFrameSize: 1 << 20},
+	} {
+		opts, err := compressionOptions(cfg)
+		require.NoError(t, err)
+
+		var compressed bytes.Buffer
+		require.NoError(t, Compress(bytes.NewReader(data), &compressed, opts...))
+
+		dec, err := zstd.NewReader(&compressed)
+		require.NoError(t, err)
+		out, err := io.ReadAll(dec)
+		dec.Close()
+		require.NoError(t, err)
+		assert.Equal(t, data, out)
+
+		var seekable bytes.Buffer
+		require.NoError(t, CompressSeekable(bytes.NewReader(data), &seekable, 64<<10, cfg.Concurrency, opts...))
+
+		r, err := export.NewSeekableReader(bytes.NewReader(seekable.Bytes()), int64(seekable.Len()))
+		require.NoError(t, err)
+		out, err = io.ReadAll(r)
+		r.Close()
+		require.NoError(t, err)
+		assert.Equal(t, data, out)
+	}
+
+	for _, cfg := range []config.CompressionConfig{
+		{Level: "0"},
+		{Level: "smallest"},
+		{Concurrency: -1},
+		{Concurrency: 4},
+		{WindowSize: 3000},
+	} {
+		_, err := compressionOptions(cfg)
+		assert.Error(t, err, "%+v", cfg)
+	}
+}
+
+func BenchmarkCompress(b *testing.B) {
+	data := benchmarkData(64 << 20)
+
+	for _, level := range []string{"fastest", "default", "better", "best"} {
+		for _, concurrency := range []int{1, 2} {
+			b.Run(fmt.Sprintf("level=%s/concurrency=%d", level, concurrency), func(b *testing.B) {
+				opts, err := compressionOptions(config.CompressionConfig{Level: level, Concurrency: concurrency})
+				require.NoError(b, err)
+
+				b.SetBytes(int64(len(data)))
+				b.ResetTimer()
+
+				var compressed countingWriter
+				for i := 0; i < b.N; i++ {
+					compressed = 0
+					if err := Compress(bytes.NewReader(data), &compressed, opts...); err != nil {
+						b.Fatal(err)
+					}
+				}
+
+				b.ReportMetric(float64(len(data))/float64(compressed), "ratio")
+			})
+		}
+	}
+}
+
+func BenchmarkCompressSeekable(b *testing.B) {
+	data := benchmarkData(64 << 20)
+
+	for _, level := range []string{"fastest", "default", "better"} {
+		for _, concurrency := range []int{1, 4, 8} {
+			b.Run(fmt.Sprintf("level=%s/concurrency=%d", level, concurrency), func(b *testing.B) {
+				opts, err := compressionOptions(config.CompressionConfig{Level: level})
+				require.NoError(b, err)
+
+				b.SetBytes(int64(len(data)))
+				b.ResetTimer()
+
+				var compressed countingWriter
+				for i := 0; i < b.N; i++ {
+					compressed = 0
+					if err := CompressSeekable(bytes.NewReader(data), &compressed, export.DefaultSeekableFrameSize, concurrency, opts...); err != nil {
+						b.Fatal(err)
+					}
+				}
+
+				b.ReportMetric(float64(len(data))/float64(compressed), "ratio")
+			})
+		}
+	}
+}
+
+type countingWriter int64
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	*c += countingWriter(len(p))
+	return len(p), nil
+}
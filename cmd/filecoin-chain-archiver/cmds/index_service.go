@@ -10,11 +10,17 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/filecoin-project/go-jsonrpc"
+	cliutil "github.com/filecoin-project/lotus/cli/util"
 	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
 
 	"github.com/filecoin-project/filecoin-chain-archiver/build"
 	"github.com/filecoin-project/filecoin-chain-archiver/pkg/config"
+	indexapi "github.com/filecoin-project/filecoin-chain-archiver/pkg/index/api"
+	indexapiclient "github.com/filecoin-project/filecoin-chain-archiver/pkg/index/api/apiclient"
 	"github.com/filecoin-project/filecoin-chain-archiver/pkg/index/service"
+	"github.com/filecoin-project/filecoin-chain-archiver/pkg/tlsutil"
 )
 
 var cmdIndexService = &cli.Command{
@@ -32,6 +38,7 @@ var cmdIndexService = &cli.Command{
 				var icfg interface{}
 
 				cfg := config.DefaultIndexServiceConfig()
+				cfg.Routes = config.DefaultRoutes()
 				icfg = cfg
 
 				bs, err := config.ConfigComment(icfg)
@@ -44,10 +51,245 @@ var cmdIndexService = &cli.Command{
 				return nil
 			},
 		},
+		{
+			Name:  "operator",
+			Usage: "commands for interacting with the running service through the operator jsonrpc api",
+			Flags: joinFlags([]cli.Flag{
+				&cli.StringFlag{
+					Name:    "operator-api",
+					Usage:   "url of operator api, prefixed with the operator token and a colon to control the cache, eg: TOKEN:http://localhost:5201",
+					EnvVars: []string{"FCA_INDEX_RESOLVER_OPERATOR_API"},
+					Value:   "http://localhost:5201",
+				},
+				&cli.StringFlag{
+					Name:    "api-info",
+					EnvVars: []string{"FCA_INDEX_RESOLVER_OPERATOR_API_INFO"},
+					Hidden:  true,
+				},
+			}, clientTLSFlags("", "FCA_INDEX_RESOLVER_OPERATOR_API")),
+			Before: func(cctx *cli.Context) error {
+				if cctx.IsSet("api-info") {
+					return nil
+				}
+
+				return cctx.Set("api-info", cctx.String("operator-api"))
+			},
+			Subcommands: []*cli.Command{
+				{
+					Name:  "version",
+					Usage: "prints local and remote version",
+					Action: func(cctx *cli.Context) error {
+						ctx := context.Background()
+
+						api, closer, err := getIndexCliClient(ctx, cctx)
+						defer closer()
+						if err != nil {
+							return err
+						}
+
+						version, err := api.Version(ctx)
+						if err != nil {
+							return err
+						}
+
+						fmt.Printf("local:  %s\n", build.Version())
+						fmt.Printf("remote: %s\n", version)
+
+						return nil
+					},
+				},
+				{
+					Name:  "log-list",
+					Usage: "list available loggers",
+					Action: func(cctx *cli.Context) error {
+						ctx := context.Background()
+
+						api, closer, err := getIndexCliClient(ctx, cctx)
+						defer closer()
+						if err != nil {
+							return err
+						}
+
+						loggers, err := api.LogList(ctx)
+						if err != nil {
+							return err
+						}
+
+						for _, logger := range loggers {
+							fmt.Println(logger)
+						}
+
+						return nil
+					},
+				},
+				{
+					Name:      "log-set-level",
+					Usage:     "set log level",
+					ArgsUsage: "<level>",
+					Description: TrimDescription(`
+						The logger flag can be specified multiple times.
+						eg) log set-level --logger foo --logger bar debug
+					`),
+					Flags: []cli.Flag{
+						&cli.StringSliceFlag{
+							Name:  "logger",
+							Usage: "limit to log system",
+							Value: &cli.StringSlice{},
+						},
+					},
+					Action: func(cctx *cli.Context) error {
+						ctx := context.Background()
+
+						api, closer, err := getIndexCliClient(ctx, cctx)
+						defer closer()
+						if err != nil {
+							return err
+						}
+
+						if !cctx.Args().Present() {
+							return fmt.Errorf("level is required")
+						}
+
+						loggers := cctx.StringSlice("logger")
+						if len(loggers) == 0 {
+							var err error
+							loggers, err = api.LogList(ctx)
+							if err != nil {
+								return err
+							}
+						}
+
+						for _, logger := range loggers {
+							if err := api.LogSetLevel(ctx, logger, cctx.Args().First()); err != nil {
+								return xerrors.Errorf("setting log level on %s: %w", logger, err)
+							}
+						}
+
+						return nil
+					},
+				},
+				{
+					Name:  "resolved",
+					Usage: "list the value currently served by each route",
+					Action: func(cctx *cli.Context) error {
+						ctx := context.Background()
+
+						api, closer, err := getIndexCliClient(ctx, cctx)
+						defer closer()
+						if err != nil {
+							return err
+						}
+
+						resolved, err := api.Resolved(ctx)
+						if err != nil {
+							return err
+						}
+
+						for _, r := range resolved {
+							value := r.Value
+							if r.Error != "" {
+								value = fmt.Sprintf("error: %s", r.Error)
+							}
+							fmt.Printf("%s\t%s\t%s\t%s\n", r.Path, r.Resolver, r.Key, value)
+						}
+
+						return nil
+					},
+				},
+				{
+					Name:  "cache-list",
+					Usage: "list cached values",
+					Action: func(cctx *cli.Context) error {
+						ctx := context.Background()
+
+						api, closer, err := getIndexCliClient(ctx, cctx)
+						defer closer()
+						if err != nil {
+							return err
+						}
+
+						caches, err := api.CacheList(ctx)
+						if err != nil {
+							return err
+						}
+
+						for _, c := range caches {
+							for _, e := range c.Entries {
+								fmt.Printf("%s\t%s\t%s\t%s\n", c.Path, e.Key, e.Value, e.Expiry)
+							}
+						}
+
+						return nil
+					},
+				},
+				{
+					Name:  "cache-flush",
+					Usage: "drop every cached value",
+					Action: func(cctx *cli.Context) error {
+						ctx := context.Background()
+
+						api, closer, err := getIndexCliClient(ctx, cctx)
+						defer closer()
+						if err != nil {
+							return err
+						}
+
+						return api.CacheFlush(ctx)
+					},
+				},
+				{
+					Name:      "cache-invalidate",
+					Usage:     "drop the cached value of a key",
+					ArgsUsage: "<key>",
+					Action: func(cctx *cli.Context) error {
+						ctx := context.Background()
+
+						api, closer, err := getIndexCliClient(ctx, cctx)
+						defer closer()
+						if err != nil {
+							return err
+						}
+
+						if !cctx.Args().Present() {
+							return fmt.Errorf("key is required")
+						}
+
+						return api.CacheInvalidate(ctx, cctx.Args().First())
+					},
+				},
+				{
+					Name:      "cache-refresh",
+					Usage:     "resolve a key again, replacing the cached value",
+					ArgsUsage: "<key>",
+					Action: func(cctx *cli.Context) error {
+						ctx := context.Background()
+
+						api, closer, err := getIndexCliClient(ctx, cctx)
+						defer closer()
+						if err != nil {
+							return err
+						}
+
+						if !cctx.Args().Present() {
+							return fmt.Errorf("key is required")
+						}
+
+						value, err := api.CacheRefresh(ctx, cctx.Args().First())
+						if err != nil {
+							return err
+						}
+
+						fmt.Println(value)
+
+						return nil
+					},
+				},
+			},
+		},
 		{
 			Name:  "run",
 			Usage: "start the service",
-			Flags: []cli.Flag{
+			Flags: joinFlags([]cli.Flag{
 				&cli.StringFlag{
 					Name:    "service-listen",
 					Usage:   "host and port to listen on",
@@ -66,13 +308,32 @@ var cmdIndexService = &cli.Command{
 					EnvVars: []string{"FCA_INDEX_RESOLVER_CONFIG_PATH"},
 					Value:   "./config.toml",
 				},
-			},
+				&cli.StringFlag{
+					Name:    "operator-token-path",
+					Usage:   "path to a file containing the bearer token required to control the cache and logging over the operator api, eg: a1b2.c3d4.e5f6",
+					EnvVars: []string{"FCA_INDEX_RESOLVER_OPERATOR_TOKEN_PATH"},
+				},
+			}, serverTLSFlags("service", "FCA_INDEX_RESOLVER_SERVICE"), serverTLSFlags("operator", "FCA_INDEX_RESOLVER_OPERATOR")),
 			Action: func(cctx *cli.Context) error {
 				ctx, cancelFunc := context.WithCancel(context.Background())
+				defer cancelFunc()
 				ctx = context.WithValue(ctx, versionKey{}, build.Version())
 
 				signalChan := make(chan os.Signal, 1)
-				signal.Notify(signalChan, syscall.SIGQUIT, syscall.SIGINT, syscall.SIGHUP, syscall.SIGTERM)
+				signal.Notify(signalChan, syscall.SIGQUIT, syscall.SIGINT, syscall.SIGTERM)
+
+				hupChan := make(chan os.Signal, 1)
+				signal.Notify(hupChan, syscall.SIGHUP)
+
+				serviceTLS, err := serverTLS(cctx, "service")
+				if err != nil {
+					return err
+				}
+
+				operatorTLS, err := serverTLS(cctx, "operator")
+				if err != nil {
+					return err
+				}
 
 				s := service.NewIndexService(ctx)
 
@@ -90,7 +351,7 @@ var cmdIndexService = &cli.Command{
 
 				go func() {
 					logger.Debugw("service running")
-					err := svr.ListenAndServe()
+					err := tlsutil.ListenAndServe(svr, serviceTLS)
 					switch err {
 					case nil:
 					case http.ErrServerClosed:
@@ -102,7 +363,7 @@ var cmdIndexService = &cli.Command{
 					}
 				}()
 
-				if err := s.SetupOperator(); err != nil {
+				if err := s.SetupOperator(cctx.String("operator-token-path")); err != nil {
 					return err
 				}
 
@@ -116,7 +377,7 @@ var cmdIndexService = &cli.Command{
 
 				go func() {
 					logger.Debugw("operator running")
-					err := osvr.ListenAndServe()
+					err := tlsutil.ListenAndServe(&osvr, operatorTLS)
 					switch err {
 					case nil:
 					case http.ErrServerClosed:
@@ -129,7 +390,13 @@ var cmdIndexService = &cli.Command{
 				}()
 
 				logger.Infow("waiting for signal")
-				<-signalChan
+				waitForSignal(signalChan, hupChan, func() {
+					reloadTLS(serviceTLS, operatorTLS)
+
+					if err := s.Reload(); err != nil {
+						logger.Errorw("failed to reload configuration, keeping the current configuration", "err", err)
+					}
+				})
 				s.Shutdown()
 
 				t := time.NewTimer(svrShutdownTimeout)
@@ -175,3 +442,24 @@ var cmdIndexService = &cli.Command{
 		},
 	},
 }
+
+func getIndexCliClient(ctx context.Context, cctx *cli.Context) (indexapi.Operator, jsonrpc.ClientCloser, error) {
+	return newIndexOperatorClient(ctx, cctx.String("api-info"), clientTLS(cctx, ""))
+}
+
+// newIndexOperatorClient connects to the operator api given as api info, eg: TOKEN:http://localhost:5201, the token
+// is only needed to control the cache.
+func newIndexOperatorClient(ctx context.Context, apiInfo string, tlsCfg tlsutil.ClientConfig) (indexapi.Operator, jsonrpc.ClientCloser, error) {
+	ai := cliutil.ParseApiInfo(apiInfo)
+	url, err := ai.DialArgs("v0")
+	if err != nil {
+		return nil, func() {}, err
+	}
+
+	opts, err := tlsutil.JSONRPCOptions(url, tlsCfg)
+	if err != nil {
+		return nil, func() {}, err
+	}
+
+	return indexapiclient.NewOperatorClient(ctx, url, ai.AuthHeader(), opts...)
+}
@@ -19,6 +19,7 @@ import (
 	"github.com/filecoin-project/filecoin-chain-archiver/pkg/nodelocker/api"
 	"github.com/filecoin-project/filecoin-chain-archiver/pkg/nodelocker/api/apiclient"
 	"github.com/filecoin-project/filecoin-chain-archiver/pkg/nodelocker/service"
+	"github.com/filecoin-project/filecoin-chain-archiver/pkg/tlsutil"
 )
 
 var (
@@ -38,7 +39,7 @@ var cmdService = &cli.Command{
 		{
 			Name:  "operator",
 			Usage: "commands for interacting with the running service through the operator jsonrpc api",
-			Flags: []cli.Flag{
+			Flags: joinFlags([]cli.Flag{
 				&cli.StringFlag{
 					Name:    "operator-api",
 					Usage:   "host and port of operator api",
@@ -50,7 +51,7 @@ var cmdService = &cli.Command{
 					EnvVars: []string{"FCA_NODELOCKER_OPERATOR_API_INFO"},
 					Hidden:  true,
 				},
-			},
+			}, clientTLSFlags("", "FCA_NODELOCKER_OPERATOR_API")),
 			Before: func(cctx *cli.Context) error {
 				if cctx.IsSet("api-info") {
 					return nil
@@ -218,7 +219,7 @@ var cmdService = &cli.Command{
 		{
 			Name:  "run",
 			Usage: "start the service",
-			Flags: []cli.Flag{
+			Flags: joinFlags([]cli.Flag{
 				&cli.StringFlag{
 					Name:    "service-listen",
 					Usage:   "host and port to listen on",
@@ -231,13 +232,27 @@ var cmdService = &cli.Command{
 					EnvVars: []string{"FCA_NODELOCKER_OPERATOR_LISTEN"},
 					Value:   "localhost:5101",
 				},
-			},
+			}, serverTLSFlags("service", "FCA_NODELOCKER_SERVICE"), serverTLSFlags("operator", "FCA_NODELOCKER_OPERATOR")),
 			Action: func(cctx *cli.Context) error {
 				ctx, cancelFunc := context.WithCancel(context.Background())
+				defer cancelFunc()
 				ctx = context.WithValue(ctx, versionKey{}, build.Version())
 
 				signalChan := make(chan os.Signal, 1)
-				signal.Notify(signalChan, syscall.SIGQUIT, syscall.SIGINT, syscall.SIGHUP, syscall.SIGTERM)
+				signal.Notify(signalChan, syscall.SIGQUIT, syscall.SIGINT, syscall.SIGTERM)
+
+				hupChan := make(chan os.Signal, 1)
+				signal.Notify(hupChan, syscall.SIGHUP)
+
+				serviceTLS, err := serverTLS(cctx, "service")
+				if err != nil {
+					return err
+				}
+
+				operatorTLS, err := serverTLS(cctx, "operator")
+				if err != nil {
+					return err
+				}
 
 				s := service.NewLockerService(ctx)
 
@@ -255,7 +270,7 @@ var cmdService = &cli.Command{
 
 				go func() {
 					logger.Debugw("service running")
-					err := svr.ListenAndServe()
+					err := tlsutil.ListenAndServe(svr, serviceTLS)
 					switch err {
 					case nil:
 					case http.ErrServerClosed:
@@ -281,7 +296,7 @@ var cmdService = &cli.Command{
 
 				go func() {
 					logger.Debugw("operator running")
-					err := osvr.ListenAndServe()
+					err := tlsutil.ListenAndServe(&osvr, operatorTLS)
 					switch err {
 					case nil:
 					case http.ErrServerClosed:
@@ -294,7 +309,9 @@ var cmdService = &cli.Command{
 				}()
 
 				logger.Infow("waiting for signal")
-				<-signalChan
+				waitForSignal(signalChan, hupChan, func() {
+					reloadTLS(serviceTLS, operatorTLS)
+				})
 				s.Shutdown()
 
 				t := time.NewTimer(svrShutdownTimeout)
@@ -348,5 +365,10 @@ func getCliClient(ctx context.Context, cctx *cli.Context) (api.Operator, jsonrpc
 		return nil, func() {}, err
 	}
 
-	return apiclient.NewOperatorClient(ctx, url, ai.AuthHeader())
+	opts, err := tlsutil.JSONRPCOptions(url, clientTLS(cctx, ""))
+	if err != nil {
+		return nil, func() {}, err
+	}
+
+	return apiclient.NewOperatorClient(ctx, url, ai.AuthHeader(), opts...)
 }
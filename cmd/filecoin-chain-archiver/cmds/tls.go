@@ -0,0 +1,106 @@
+package cmds
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/filecoin-project/filecoin-chain-archiver/pkg/tlsutil"
+)
+
+// serverTLSFlags returns the flags configuring TLS of the listener, eg: service-tls-cert-path
+func serverTLSFlags(listener, envPrefix string) []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:    listener + "-tls-cert-path",
+			Usage:   fmt.Sprintf("path to the certificate served by the %s listener, enables tls", listener),
+			EnvVars: []string{envPrefix + "_TLS_CERT_PATH"},
+		},
+		&cli.StringFlag{
+			Name:    listener + "-tls-key-path",
+			Usage:   fmt.Sprintf("path to the private key of the %s listener certificate", listener),
+			EnvVars: []string{envPrefix + "_TLS_KEY_PATH"},
+		},
+		&cli.StringFlag{
+			Name:    listener + "-tls-client-ca-path",
+			Usage:   fmt.Sprintf("path to the CAs which must have signed the certificate of %s clients", listener),
+			EnvVars: []string{envPrefix + "_TLS_CLIENT_CA_PATH"},
+		},
+	}
+}
+
+// serverTLS returns the certificates of the listener, or nil when it serves plain http.
+func serverTLS(cctx *cli.Context, listener string) (*tlsutil.Server, error) {
+	cfg := tlsutil.ServerConfig{
+		CertPath:     cctx.String(listener + "-tls-cert-path"),
+		KeyPath:      cctx.String(listener + "-tls-key-path"),
+		ClientCAPath: cctx.String(listener + "-tls-client-ca-path"),
+	}
+
+	if !cfg.Enabled() {
+		if cfg.KeyPath != "" || cfg.ClientCAPath != "" {
+			return nil, fmt.Errorf("%s-tls-cert-path is required to serve tls", listener)
+		}
+		return nil, nil
+	}
+
+	return tlsutil.NewServer(cfg)
+}
+
+// clientTLSFlags returns the flags configuring TLS of a client, eg: nodelocker-tls-ca-path
+func clientTLSFlags(prefix, envPrefix string) []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:    prefix + "tls-ca-path",
+			Usage:   "path to the CAs used to verify the server certificate, defaults to the system roots",
+			EnvVars: []string{envPrefix + "_TLS_CA_PATH"},
+		},
+		&cli.StringFlag{
+			Name:    prefix + "tls-cert-path",
+			Usage:   "path to the client certificate presented to the server",
+			EnvVars: []string{envPrefix + "_TLS_CERT_PATH"},
+		},
+		&cli.StringFlag{
+			Name:    prefix + "tls-key-path",
+			Usage:   "path to the private key of the client certificate",
+			EnvVars: []string{envPrefix + "_TLS_KEY_PATH"},
+		},
+	}
+}
+
+func clientTLS(cctx *cli.Context, prefix string) tlsutil.ClientConfig {
+	return tlsutil.ClientConfig{
+		CAPath:   cctx.String(prefix + "tls-ca-path"),
+		CertPath: cctx.String(prefix + "tls-cert-path"),
+		KeyPath:  cctx.String(prefix + "tls-key-path"),
+	}
+}
+
+// reloadTLS reads the certificates of the listeners again, those which fail to load keep serving their previous
+// certificates.
+func reloadTLS(servers ...*tlsutil.Server) {
+	for _, s := range servers {
+		if s == nil {
+			continue
+		}
+
+		if err := s.Reload(); err != nil {
+			logger.Errorw("failed to reload certificates", "err", err)
+		}
+	}
+}
+
+// waitForSignal blocks until a signal is received on signalChan, calling reload for each signal on hupChan.
+func waitForSignal(signalChan, hupChan <-chan os.Signal, reload func()) {
+	for {
+		select {
+		case <-hupChan:
+			logger.Infow("reloading")
+			reload()
+		case sig := <-signalChan:
+			logger.Infow("received signal", "signal", sig.String())
+			return
+		}
+	}
+}
@@ -12,6 +12,7 @@ import (
 
 	"github.com/filecoin-project/filecoin-chain-archiver/pkg/config"
 	cliutil "github.com/filecoin-project/lotus/cli/util"
+	"github.com/urfave/cli/v2"
 )
 
 func NodeMultiaddrs(cfg *config.ExportWorkerConfig) ([]string, error) {
@@ -46,3 +47,12 @@ func CreateLotusClient(ctx context.Context, multiaddr string) (api.FullNode, jso
 
 	return client.NewFullNodeRPCV1(ctx, darg, ainfo.AuthHeader())
 }
+
+func joinFlags(groups ...[]cli.Flag) []cli.Flag {
+	var flags []cli.Flag
+	for _, g := range groups {
+		flags = append(flags, g...)
+	}
+
+	return flags
+}
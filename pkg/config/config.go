@@ -5,13 +5,46 @@ import (
 	"io"
 	"net/url"
 	"os"
+	"time"
 
 	"github.com/BurntSushi/toml"
 	"golang.org/x/xerrors"
 )
 
 func DefaultIndexServiceConfig() *IndexServiceConfig {
-	return &IndexServiceConfig{}
+	return &IndexServiceConfig{
+		Cache: CacheConfig{
+			TTL:        5 * time.Minute,
+			MaxStale:   time.Hour,
+			MaxEntries: 1024,
+		},
+		MirrorCheck: MirrorCheckConfig{
+			Interval: 30 * time.Second,
+			Timeout:  10 * time.Second,
+		},
+		Freshness: FreshnessConfig{
+			Interval: time.Minute,
+		},
+		Decompress: DecompressConfig{
+			MaxConcurrent: 4,
+			MaxWindow:     128 << 20,
+		},
+		SnapshotIndexRefreshInterval: 5 * time.Minute,
+	}
+}
+
+// DefaultRoutes are served when the configuration does not define any routes. They are not part of the default
+// config, as decoding merges the first configured route into the first default one.
+func DefaultRoutes() []RouteConfig {
+	return []RouteConfig{
+		{
+			Path:          "/minimal/latest",
+			Aliases:       []string{"/minimal/latest.zst"},
+			Key:           "minimal/latest",
+			Mode:          RouteModeRedirect,
+			PresignExpiry: DefaultPresignExpiry,
+		},
+	}
 }
 
 func DefaultExportWorkerConfig() *ExportWorkerConfig {
@@ -38,10 +71,32 @@ func (u URL) MarshalText() ([]byte, error) {
 type Node struct {
 	Address   string
 	TokenPath string
+
+	// RestartStrategy controls how the node is restarted before an export: supervisor, command or none
+	RestartStrategy string
+	// RestartCommand is the shell command run by the command restart strategy
+	RestartCommand string
 }
 
 type ExportWorkerConfig struct {
 	Nodes []Node
+	// Compression tunes the zstd encoder of snapshots
+	Compression CompressionConfig
+}
+
+type CompressionConfig struct {
+	// Level is a zstd level from 1 to 22, or one of fastest, default, better or best. Levels are mapped to the closest
+	// of the four the encoder implements.
+	Level string
+	// Concurrency is the number of goroutines the encoder may use, 1 disables async compression, defaults to GOMAXPROCS.
+	// A single frame uses at most 2, higher values require SeekableFrameSize and compress that many frames at once
+	Concurrency int
+	// WindowSize is the back-reference distance in bytes, a power of two between 1KiB and 512MiB, defaults to the
+	// window of the level
+	WindowSize int
+	// SeekableFrameSize writes the snapshot as independent frames of this many uncompressed bytes followed by a seek
+	// table, so it can be read from any offset, 0 writes a single frame
+	SeekableFrameSize int
 }
 
 type S3ResolverConfig struct {
@@ -49,16 +104,173 @@ type S3ResolverConfig struct {
 	Bucket        string
 	AccessKeyPath string
 	SecretKeyPath string
+
+	// RetrievalEndpointPrefix is the URL prefix where objects in the bucket can be retrieved from
+	RetrievalEndpointPrefix string
+	// Region of the bucket, looked up from the endpoint when empty
+	Region string
+}
+
+const (
+	// DefaultResolverName refers to the resolver configured by IndexServiceConfig.S3Resolver
+	DefaultResolverName = "default"
+
+	ResolverTypeS3         = "s3"
+	ResolverTypeFilesystem = "fs"
+	ResolverTypeChain      = "chain"
+
+	// RouteModeRedirect redirects clients to the retrieval endpoint of the snapshot
+	RouteModeRedirect = "redirect"
+	// RouteModeProxy streams the snapshot from storage through the service
+	RouteModeProxy = "proxy"
+	// RouteModePresign redirects clients to a time limited presigned URL of the snapshot
+	RouteModePresign = "presign"
+
+	DefaultPresignExpiry = time.Hour
+)
+
+type FilesystemResolverConfig struct {
+	// Path of the directory objects are stored under, laid out the same as the bucket, eg: <Path>/minimal/latest
+	Path string
+
+	// RetrievalEndpointPrefix is the URL prefix where files in the directory can be retrieved from
+	RetrievalEndpointPrefix string
+}
+
+type ResolverConfig struct {
+	Name string
+	// Type of the resolver, one of s3 (default), fs or chain
+	Type       string
+	S3         S3ResolverConfig
+	Filesystem FilesystemResolverConfig
+	// Chain is the names of the resolvers tried in order by a chain resolver. They must be configured before the
+	// chain.
+	Chain []string
+}
+
+type RouteConfig struct {
+	// Path the latest snapshot is served on, eg: /minimal/latest. The listing and lookup routes are served under the
+	// same parent path, eg: /minimal/snapshots
+	Path string
+	// Aliases are paths which redirect to Path
+	Aliases []string
+	// Resolver is the name of the resolver used for the route, defaults to the S3Resolver
+	Resolver string
+	// Bucket overrides the bucket of s3 resolvers, including those in a chain
+	Bucket string
+	// Key of the object holding the location of the latest snapshot, eg: minimal/latest. Snapshots are listed from
+	// the same parent key.
+	Key string
+	// Mode is how snapshots are served, either redirect (default), proxy or presign. Proxy and presign do not require
+	// the bucket to be public. Proxy supports range requests so downloads can be resumed.
+	Mode string
+	// PresignExpiry is how long presigned URLs are valid for, at most 7 days
+	PresignExpiry time.Duration
+	// Mirrors are retrieval endpoints holding copies of the snapshots. Redirects are sent to a healthy mirror, or to
+	// the resolved location when none are healthy. Only used by the redirect mode.
+	Mirrors []MirrorConfig
+	// Decompress serves the latest snapshot decompressed on Path with a .car suffix, eg: /minimal/latest.car
+	Decompress bool
+	// TokensPath is a file of client tokens, one `name:token` per line. When set, requests must provide a token as a
+	// bearer authorization header or the token query parameter.
+	TokensPath string
+}
+
+type MirrorConfig struct {
+	// Prefix is the URL prefix objects can be retrieved from, eg: https://mirror.example.com/
+	Prefix string
+	// Weight is the share of requests sent to the mirror relative to the others, defaults to 1
+	Weight int
+	// Region is matched against the X-Mirror-Region header of requests to prefer nearby mirrors
+	Region string
+}
+
+type MirrorCheckConfig struct {
+	// Interval between health checks of each mirror
+	Interval time.Duration
+	// Timeout of each health check
+	Timeout time.Duration
+}
+
+type FreshnessConfig struct {
+	// MaxAge is the age past which the latest snapshot of a route is stale, 0 disables the check and reports every
+	// route fresh
+	MaxAge time.Duration
+	// Interval between checks of the latest snapshot of each route
+	Interval time.Duration
+	// Readiness fails the readiness check while any route is stale
+	Readiness bool
+}
+
+type DecompressConfig struct {
+	// MaxConcurrent is the number of decompressed downloads served at once, further requests are refused. Each holds
+	// up to MaxWindow bytes of memory
+	MaxConcurrent int
+	// MaxWindow is the largest zstd window in bytes decoded, snapshots compressed with a larger window are refused.
+	// Defaults to 128MiB, the largest the zstd cli decodes without --long
+	MaxWindow int
+}
+
+type RateLimitConfig struct {
+	// RequestsPerSecond is the rate at which each client may make requests, 0 disables the limit
+	RequestsPerSecond float64
+	// Burst is the number of requests a client may make at once, defaults to 1
+	Burst int
+	// MaxConcurrent is the number of requests served at once over all clients, 0 disables the limit. Proxied and
+	// decompressed downloads are not counted once they start streaming
+	MaxConcurrent int
+	// TrustedProxies are the addresses or CIDRs of proxies whose X-Forwarded-For header identifies the client, and
+	// whose X-Forwarded-Proto header is the scheme of the request
+	TrustedProxies []string
+}
+
+type CacheConfig struct {
+	// TTL is how long resolved values and listings are cached before they are refreshed
+	TTL time.Duration
+	// MaxStale is how long past the TTL a resolved value or listing may be served while it is refreshed, or when
+	// refreshing fails
+	MaxStale time.Duration
+	// MaxEntries bounds the number of resolved values and listings cached per route
+	MaxEntries int
 }
 
 type IndexServiceConfig struct {
 	S3Resolver S3ResolverConfig
+	Resolvers  []ResolverConfig
+	Routes     []RouteConfig
+	Cache      CacheConfig
+	// MirrorCheck controls the health checks of route mirrors
+	MirrorCheck MirrorCheckConfig
+	// Freshness controls the checks of the age of the latest snapshots, served on /health/freshness
+	Freshness FreshnessConfig
+	// Decompress limits the decompressed downloads of routes
+	Decompress DecompressConfig
+	// RateLimit limits the requests made by each client and served at once
+	RateLimit RateLimitConfig
+
+	// SnapshotIndexRefreshInterval is how often the snapshots used to resolve by height and time are listed
+	SnapshotIndexRefreshInterval time.Duration
+}
+
+// setDefaultRoutes serves the DefaultRoutes when no routes are configured.
+func (c *IndexServiceConfig) setDefaultRoutes() {
+	if len(c.Routes) == 0 {
+		c.Routes = DefaultRoutes()
+	}
+}
+
+// decodedDefaulter is implemented by configs with defaults which are only set after decoding
+type decodedDefaulter interface {
+	setDefaultRoutes()
 }
 
 func FromFile(path string, def interface{}) (interface{}, error) {
 	file, err := os.Open(path)
 	switch {
 	case os.IsNotExist(err):
+		if d, ok := def.(decodedDefaulter); ok {
+			d.setDefaultRoutes()
+		}
 		return def, nil
 	case err != nil:
 		return nil, err
@@ -75,6 +287,10 @@ func FromReader(reader io.Reader, def interface{}) (interface{}, error) {
 		return nil, err
 	}
 
+	if d, ok := cfg.(decodedDefaulter); ok {
+		d.setDefaultRoutes()
+	}
+
 	return cfg, nil
 }
 
@@ -0,0 +1,28 @@
+package config
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIndexServiceConfigRoutes(t *testing.T) {
+	icfg, err := FromReader(strings.NewReader(""), DefaultIndexServiceConfig())
+	require.NoError(t, err)
+	assert.Equal(t, DefaultRoutes(), icfg.(*IndexServiceConfig).Routes)
+
+	// configured routes replace the default ones rather than being merged into them
+	icfg, err = FromReader(strings.NewReader(`
+[[Routes]]
+  Path = "/calibnet/latest"
+  Key = "calibnet/latest"
+`), DefaultIndexServiceConfig())
+	require.NoError(t, err)
+
+	routes := icfg.(*IndexServiceConfig).Routes
+	require.Len(t, routes, 1)
+	assert.Equal(t, RouteConfig{Path: "/calibnet/latest", Key: "calibnet/latest"}, routes[0])
+	assert.Empty(t, routes[0].Aliases)
+}
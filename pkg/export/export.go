@@ -2,7 +2,7 @@ package export
 
 import (
 	"context"
-	"fmt"
+	"errors"
 	"io"
 	"sync"
 	"time"
@@ -11,6 +11,7 @@ import (
 	"github.com/filecoin-project/lotus/api"
 	"github.com/filecoin-project/lotus/chain/types"
 
+	"github.com/google/uuid"
 	"github.com/ipfs/go-log/v2"
 
 	"golang.org/x/xerrors"
@@ -68,6 +69,29 @@ func waitAPIDown(ctx context.Context, node api.FullNode) error {
 	}
 }
 
+// waitRestarted waits until the node is no longer serving the given session, either because it went offline or
+// because it has already come back with a new session.
+func waitRestarted(ctx context.Context, node api.FullNode, session uuid.UUID) error {
+	ctx, cancel := context.WithTimeout(ctx, 300*time.Second)
+	defer cancel()
+
+	logger.Infow("waiting for node to restart", "session", session)
+	for {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		current, err := node.Session(ctx)
+		if err == nil && current == session {
+			logger.Debugw("not restarted yet")
+			time.Sleep(time.Second)
+			continue
+		}
+
+		return nil
+	}
+}
+
 func waitAPI(ctx context.Context, node api.FullNode) error {
 	ctx, cancel := context.WithTimeout(ctx, 300*time.Second)
 	defer cancel()
@@ -89,83 +113,215 @@ func waitAPI(ctx context.Context, node api.FullNode) error {
 	}
 }
 
+var (
+	// ErrExportStalled is returned when the node stops sending data for longer than the stall timeout.
+	ErrExportStalled = errors.New("export stalled")
+	// ErrExportDeadline is returned when the export does not finish within the deadline.
+	ErrExportDeadline = errors.New("export deadline exceeded")
+)
+
+// Watchdog bounds how long an export may run. A zero value disables the check.
+type Watchdog struct {
+	// StallTimeout is the longest the export may wait on the node for data. Time spent writing to the output, such as
+	// an upload applying backpressure, is not counted.
+	StallTimeout time.Duration
+	// Deadline is the longest the export may take overall, including restarting the node
+	Deadline time.Duration
+}
+
 type Export struct {
 	node       api.FullNode
 	tsk        types.TipSetKey
 	nroots     abi.ChainEpoch
 	oldmsgskip bool
 	output     io.WriteCloser
+	restart    RestartStrategy
+	watchdog   Watchdog
 
-	sizeMu sync.Mutex
-	size   int
-
-	finished bool
+	statusMu sync.Mutex
+	status   Status
 }
 
-func NewExport(node api.FullNode, tsk types.TipSetKey, nroots abi.ChainEpoch, oldmsgskip bool, output io.WriteCloser) *Export {
+func NewExport(node api.FullNode, tsk types.TipSetKey, nroots abi.ChainEpoch, oldmsgskip bool, output io.WriteCloser, restart RestartStrategy, watchdog Watchdog) *Export {
 	return &Export{
 		node:       node,
 		tsk:        tsk,
 		nroots:     nroots,
 		oldmsgskip: oldmsgskip,
 		output:     output,
-		sizeMu:     sync.Mutex{},
-		size:       0,
-		finished:   false,
+		restart:    restart,
+		watchdog:   watchdog,
+		status: Status{
+			Phase: PhasePending,
+		},
 	}
 }
 
 func (e *Export) Progress() (int, bool) {
-	defer e.sizeMu.Unlock()
-	e.sizeMu.Lock()
+	defer e.statusMu.Unlock()
+	e.statusMu.Lock()
+
+	return e.status.Bytes, e.status.Phase.Final()
+}
+
+// Status returns a copy of the current export status.
+func (e *Export) Status() Status {
+	defer e.statusMu.Unlock()
+	e.statusMu.Lock()
+
+	status := e.status
+	status.Phases = append([]PhaseRecord(nil), e.status.Phases...)
+
+	// the current phase holds the total at its start until it ends
+	if n := len(status.Phases); n > 0 && status.Phases[n-1].Ended.IsZero() {
+		status.Phases[n-1].Bytes = status.Bytes - status.Phases[n-1].Bytes
+	}
 
-	return e.size, e.finished
+	return status
 }
 
 func (e *Export) update(more int) int {
-	defer e.sizeMu.Unlock()
-	e.sizeMu.Lock()
-	e.size = e.size + more
+	defer e.statusMu.Unlock()
+	e.statusMu.Lock()
+	e.status.Bytes = e.status.Bytes + more
+	e.status.Updated = time.Now()
 	return more
 }
 
-func (e *Export) done() {
-	e.output.Close()
-	e.finished = true
+func (e *Export) transition(phase Phase) {
+	defer e.statusMu.Unlock()
+	e.statusMu.Lock()
+
+	e.transitionLocked(phase, time.Now())
 }
 
-func (e *Export) Export(ctx context.Context) error {
-	defer e.done()
-	if err := e.node.Shutdown(ctx); err != nil {
-		return err
+func (e *Export) transitionLocked(phase Phase, now time.Time) {
+	prev := e.status.Phase
+	if prev.Final() {
+		return
+	}
+
+	var elapsed time.Duration
+	if n := len(e.status.Phases); n > 0 {
+		current := &e.status.Phases[n-1]
+		current.Ended = now
+		current.Bytes = e.status.Bytes - current.Bytes
+		elapsed = now.Sub(current.Started)
+	} else {
+		e.status.Started = now
 	}
 
-	if err := waitAPIDown(ctx, e.node); err != nil {
-		return fmt.Errorf("node failed to go offline: %w", err)
+	e.status.Phase = phase
+	e.status.PhaseStarted = now
+
+	if !phase.Final() {
+		// Bytes holds the total at the start of the phase until the phase ends
+		e.status.Phases = append(e.status.Phases, PhaseRecord{
+			Phase:   phase,
+			Started: now,
+			Bytes:   e.status.Bytes,
+		})
+	}
+
+	logger.Infow("export phase", "phase", phase, "previous", prev, "previous_elapsed", elapsed, "size", e.status.Bytes)
+}
+
+// errorCloser is implemented by outputs which can pass the reason for closing to their reader, such as io.PipeWriter.
+type errorCloser interface {
+	CloseWithError(error) error
+}
+
+func (e *Export) done(err error) {
+	if ec, ok := e.output.(errorCloser); ok && err != nil {
+		ec.CloseWithError(err)
+	} else {
+		e.output.Close()
 	}
 
-	if err := waitAPI(ctx, e.node); err != nil {
-		return fmt.Errorf("node failed to come back online: %w", err)
+	defer e.statusMu.Unlock()
+	e.statusMu.Lock()
+
+	if err != nil {
+		e.status.Error = err.Error()
+		e.transitionLocked(PhaseFailed, time.Now())
+		return
 	}
 
-	logger.Infow("starting export")
+	e.transitionLocked(PhaseCompleted, time.Now())
+}
+
+func (e *Export) Export(ctx context.Context) (err error) {
+	defer func() {
+		e.done(err)
+	}()
+
+	if e.watchdog.Deadline > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, e.watchdog.Deadline)
+		defer cancel()
+	}
+
+	if err := e.restart.Restart(ctx, e.node, e.transition); err != nil {
+		return deadlineError(ctx, err)
+	}
+
+	// cancelling the context stops the node from streaming when the export is aborted
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	e.transition(PhaseExporting)
 	stream, err := e.node.ChainExport(ctx, e.nroots, e.oldmsgskip, e.tsk)
 	if err != nil {
-		return err
+		return deadlineError(ctx, err)
 	}
 
-	var last bool
-	for b := range stream {
-		last = e.update(len(b)) == 0
+	var stalled <-chan time.Time
+	if e.watchdog.StallTimeout > 0 {
+		stalled = time.After(e.watchdog.StallTimeout)
+	}
+
+	// waiting is when the export started waiting on the node, time spent writing to the output is not a stall
+	waiting := time.Now()
 
-		if _, err := e.output.Write(b); err != nil {
-			return err
+	var last bool
+	for {
+		select {
+		case b, ok := <-stream:
+			if !ok {
+				if !last {
+					return xerrors.Errorf("incomplete export (remote connection lost?)")
+				}
+
+				return nil
+			}
+
+			last = e.update(len(b)) == 0
+
+			if _, err := e.output.Write(b); err != nil {
+				return err
+			}
+			waiting = time.Now()
+		case <-stalled:
+			// rather than resetting the timer on every write, it is rearmed for the time remaining since the export
+			// started waiting on the node
+			idle := time.Since(waiting)
+			if idle < e.watchdog.StallTimeout {
+				stalled = time.After(e.watchdog.StallTimeout - idle)
+				continue
+			}
+
+			logger.Errorw("export stalled", "idle", idle)
+			return xerrors.Errorf("no data received for %s: %w", idle.Round(time.Second), ErrExportStalled)
+		case <-ctx.Done():
+			return deadlineError(ctx, ctx.Err())
 		}
 	}
+}
 
-	if !last {
-		return xerrors.Errorf("incomplete export (remote connection lost?)")
+func deadlineError(ctx context.Context, err error) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return xerrors.Errorf("%s: %w", err, ErrExportDeadline)
 	}
 
-	return nil
+	return err
 }
@@ -1,12 +1,19 @@
 package export
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
 	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/chain/types"
 )
 
 func TestGetNextSnapshotHeight(t *testing.T) {
@@ -23,3 +30,156 @@ func TestGetNextSnapshotHeight(t *testing.T) {
 	assert.Equal(t, abi.ChainEpoch(600), GetNextSnapshotHeight(585, 100, 15, false))
 	assert.Equal(t, abi.ChainEpoch(600), GetNextSnapshotHeight(595, 100, 15, false))
 }
+
+type streamNode struct {
+	api.FullNode
+	stream chan []byte
+}
+
+func (n *streamNode) ChainExport(ctx context.Context, nroots abi.ChainEpoch, oldmsgskip bool, tsk types.TipSetKey) (<-chan []byte, error) {
+	return n.stream, nil
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+type slowWriter struct {
+	io.Writer
+	delay time.Duration
+}
+
+func (w slowWriter) Write(p []byte) (int, error) {
+	time.Sleep(w.delay)
+	return w.Writer.Write(p)
+}
+
+func TestExportWatchdog(t *testing.T) {
+	t.Run("complete", func(t *testing.T) {
+		node := &streamNode{stream: make(chan []byte, 3)}
+		node.stream <- []byte("data")
+		node.stream <- []byte{}
+		close(node.stream)
+
+		var buf bytes.Buffer
+		e := NewExport(node, types.EmptyTSK, 10, true, nopWriteCloser{&buf}, &NoRestart{}, Watchdog{StallTimeout: time.Second})
+		require.NoError(t, e.Export(context.Background()))
+		assert.Equal(t, "data", buf.String())
+	})
+
+	t.Run("stalled", func(t *testing.T) {
+		node := &streamNode{stream: make(chan []byte, 1)}
+		node.stream <- []byte("data")
+
+		e := NewExport(node, types.EmptyTSK, 10, true, nopWriteCloser{io.Discard}, &NoRestart{}, Watchdog{StallTimeout: 50 * time.Millisecond})
+		err := e.Export(context.Background())
+		assert.ErrorIs(t, err, ErrExportStalled)
+
+		size, done := e.Progress()
+		assert.Equal(t, 4, size)
+		assert.True(t, done)
+
+		status := e.Status()
+		assert.Equal(t, PhaseFailed, status.Phase)
+		assert.Contains(t, status.Error, "export stalled")
+	})
+
+	t.Run("slow output", func(t *testing.T) {
+		node := &streamNode{stream: make(chan []byte, 4)}
+		node.stream <- []byte("data")
+		node.stream <- []byte("data")
+		node.stream <- []byte{}
+		close(node.stream)
+
+		// writes blocking for longer than the stall timeout are not counted as the node stalling
+		var buf bytes.Buffer
+		output := slowWriter{Writer: &buf, delay: 100 * time.Millisecond}
+		e := NewExport(node, types.EmptyTSK, 10, true, nopWriteCloser{output}, &NoRestart{}, Watchdog{StallTimeout: 50 * time.Millisecond})
+		require.NoError(t, e.Export(context.Background()))
+		assert.Equal(t, "datadata", buf.String())
+	})
+
+	t.Run("deadline", func(t *testing.T) {
+		node := &streamNode{stream: make(chan []byte)}
+		go func() {
+			for i := 0; i < 10; i++ {
+				node.stream <- []byte("data")
+				time.Sleep(20 * time.Millisecond)
+			}
+		}()
+
+		e := NewExport(node, types.EmptyTSK, 10, true, nopWriteCloser{io.Discard}, &NoRestart{}, Watchdog{StallTimeout: time.Second, Deadline: 50 * time.Millisecond})
+		assert.ErrorIs(t, e.Export(context.Background()), ErrExportDeadline)
+	})
+}
+
+type restartNode struct {
+	streamNode
+	versionCalls int
+}
+
+func (n *restartNode) Shutdown(ctx context.Context) error {
+	return nil
+}
+
+func (n *restartNode) Version(ctx context.Context) (api.APIVersion, error) {
+	// the first call is made while waiting for the node to go offline
+	n.versionCalls++
+	if n.versionCalls == 1 {
+		return api.APIVersion{}, errors.New("offline")
+	}
+
+	return api.APIVersion{}, nil
+}
+
+func TestExportStatus(t *testing.T) {
+	node := &restartNode{streamNode: streamNode{stream: make(chan []byte, 3)}}
+	node.stream <- []byte("data")
+	node.stream <- []byte{}
+	close(node.stream)
+
+	e := NewExport(node, types.EmptyTSK, 10, true, nopWriteCloser{io.Discard}, &SupervisorRestart{}, Watchdog{})
+	assert.Equal(t, PhasePending, e.Status().Phase)
+
+	require.NoError(t, e.Export(context.Background()))
+
+	status := e.Status()
+	assert.Equal(t, PhaseCompleted, status.Phase)
+	assert.Equal(t, 4, status.Bytes)
+	assert.Empty(t, status.Error)
+
+	var phases []Phase
+	for _, r := range status.Phases {
+		phases = append(phases, r.Phase)
+		assert.False(t, r.Ended.IsZero())
+	}
+
+	assert.Equal(t, []Phase{PhaseShuttingDown, PhaseWaitingOffline, PhaseWaitingOnline, PhaseExporting}, phases)
+	assert.Equal(t, 4, status.Phases[3].Bytes)
+	assert.Equal(t, 0, status.Phases[0].Bytes)
+}
+
+func TestExportStatusCurrentPhase(t *testing.T) {
+	node := &streamNode{stream: make(chan []byte, 3)}
+	node.stream <- []byte("data")
+
+	e := NewExport(node, types.EmptyTSK, 10, true, nopWriteCloser{io.Discard}, &NoRestart{}, Watchdog{})
+
+	errs := make(chan error, 1)
+	go func() { errs <- e.Export(context.Background()) }()
+
+	// the phase in progress reports the bytes exported in it so far
+	require.Eventually(t, func() bool { return e.Status().Bytes == 4 }, time.Second, 5*time.Millisecond)
+	status := e.Status()
+	require.Equal(t, PhaseExporting, status.Phase)
+	assert.Equal(t, 4, status.Phases[len(status.Phases)-1].Bytes)
+
+	node.stream <- []byte{}
+	close(node.stream)
+	require.NoError(t, <-errs)
+
+	status = e.Status()
+	assert.Equal(t, 4, status.Phases[len(status.Phases)-1].Bytes)
+}
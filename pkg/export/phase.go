@@ -0,0 +1,80 @@
+package export
+
+import (
+	"time"
+)
+
+// Phase is a step in the lifecycle of an export.
+type Phase string
+
+const (
+	PhasePending        Phase = "pending"
+	PhaseShuttingDown   Phase = "shutting_down"
+	PhaseWaitingOffline Phase = "waiting_offline"
+	PhaseWaitingOnline  Phase = "waiting_online"
+	PhaseExporting      Phase = "exporting"
+	PhaseCompleted      Phase = "completed"
+	PhaseFailed         Phase = "failed"
+)
+
+// Final reports if the export can no longer change phase.
+func (p Phase) Final() bool {
+	return p == PhaseCompleted || p == PhaseFailed
+}
+
+// Transition moves an export into the given phase. It is passed to a RestartStrategy so that the steps of a restart
+// are reflected in the export status.
+type Transition func(Phase)
+
+// PhaseRecord describes a phase the export has been through.
+type PhaseRecord struct {
+	Phase   Phase
+	Started time.Time
+	// Ended is zero for the current phase
+	Ended time.Time
+	// Bytes is the number of bytes exported while in the phase, so far for the current phase
+	Bytes int
+}
+
+// Status is a snapshot of the state of an export.
+type Status struct {
+	Phase        Phase
+	Started      time.Time
+	PhaseStarted time.Time
+	// Updated is when data was last received from the node
+	Updated time.Time
+	Bytes   int
+	Error   string
+	Phases  []PhaseRecord
+}
+
+// Duration is how long the export has been running, or ran for once it has finished.
+func (s Status) Duration() time.Duration {
+	if s.Started.IsZero() {
+		return 0
+	}
+
+	if s.Phase.Final() {
+		return s.PhaseStarted.Sub(s.Started)
+	}
+
+	return time.Since(s.Started)
+}
+
+// PhaseDuration returns the total time spent in the given phase.
+func (s Status) PhaseDuration(phase Phase) time.Duration {
+	var d time.Duration
+	for _, r := range s.Phases {
+		if r.Phase != phase {
+			continue
+		}
+
+		if r.Ended.IsZero() {
+			d += time.Since(r.Started)
+		} else {
+			d += r.Ended.Sub(r.Started)
+		}
+	}
+
+	return d
+}
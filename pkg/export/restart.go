@@ -0,0 +1,113 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+
+	"github.com/filecoin-project/lotus/api"
+)
+
+const (
+	RestartStrategySupervisor = "supervisor"
+	RestartStrategyCommand    = "command"
+	RestartStrategyNone       = "none"
+)
+
+// RestartStrategy brings a node through a restart before an export is started. Restarting the node resets its memory
+// usage, which the export is sensitive to.
+type RestartStrategy interface {
+	Restart(context.Context, api.FullNode, Transition) error
+}
+
+// NewRestartStrategy returns the restart strategy identified by name. An empty name selects the supervisor strategy.
+func NewRestartStrategy(name, command string) (RestartStrategy, error) {
+	switch name {
+	case "", RestartStrategySupervisor:
+		return &SupervisorRestart{}, nil
+	case RestartStrategyCommand:
+		if command == "" {
+			return nil, fmt.Errorf("restart strategy %q requires a command", name)
+		}
+		return &CommandRestart{Command: command}, nil
+	case RestartStrategyNone:
+		return &NoRestart{}, nil
+	default:
+		return nil, fmt.Errorf("unknown restart strategy %q", name)
+	}
+}
+
+// SupervisorRestart shuts the node down over rpc and relies on an external supervisor to start it again.
+//
+// eg: while true; do lotus daemon; done
+type SupervisorRestart struct{}
+
+func (s *SupervisorRestart) Restart(ctx context.Context, node api.FullNode, transition Transition) error {
+	transition(PhaseShuttingDown)
+	if err := node.Shutdown(ctx); err != nil {
+		return err
+	}
+
+	transition(PhaseWaitingOffline)
+	if err := waitAPIDown(ctx, node); err != nil {
+		return fmt.Errorf("node failed to go offline: %w", err)
+	}
+
+	transition(PhaseWaitingOnline)
+	if err := waitAPI(ctx, node); err != nil {
+		return fmt.Errorf("node failed to come back online: %w", err)
+	}
+
+	return nil
+}
+
+// CommandRestart runs a shell command which is expected to restart the node, eg: systemctl restart lotus-daemon. The
+// command may return before the node has gone down, the export waits for the session of the node to change.
+type CommandRestart struct {
+	Command string
+}
+
+func (c *CommandRestart) Restart(ctx context.Context, node api.FullNode, transition Transition) error {
+	transition(PhaseShuttingDown)
+
+	// the session identifies the running node, asynchronous commands leave it running for a while after returning
+	session, err := node.Session(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get node session: %w", err)
+	}
+
+	logger.Infow("running restart command", "command", c.Command)
+
+	var out bytes.Buffer
+	cmd := exec.CommandContext(ctx, "sh", "-c", c.Command)
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+
+	if err := cmd.Run(); err != nil {
+		logger.Errorw("restart command failed", "command", c.Command, "output", out.String())
+		return fmt.Errorf("restart command failed: %w", err)
+	}
+
+	logger.Debugw("restart command finished", "output", out.String())
+
+	transition(PhaseWaitingOffline)
+	if err := waitRestarted(ctx, node, session); err != nil {
+		return fmt.Errorf("node failed to restart: %w", err)
+	}
+
+	transition(PhaseWaitingOnline)
+	if err := waitAPI(ctx, node); err != nil {
+		return fmt.Errorf("node failed to come back online: %w", err)
+	}
+
+	return nil
+}
+
+// NoRestart leaves the node running, for nodes which do not need their memory reset before an export.
+type NoRestart struct{}
+
+func (n *NoRestart) Restart(ctx context.Context, node api.FullNode, transition Transition) error {
+	logger.Infow("skipping node restart")
+	return nil
+}
@@ -0,0 +1,70 @@
+package export
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/lotus/api"
+)
+
+// sessionNode serves the given sessions in turn, a nil session is served as the node being offline. The last one is
+// served once the others are used.
+type sessionNode struct {
+	api.FullNode
+
+	mu       sync.Mutex
+	sessions []*uuid.UUID
+}
+
+func (n *sessionNode) next() *uuid.UUID {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	s := n.sessions[0]
+	if len(n.sessions) > 1 {
+		n.sessions = n.sessions[1:]
+	}
+	return s
+}
+
+func (n *sessionNode) Session(ctx context.Context) (uuid.UUID, error) {
+	if s := n.next(); s != nil {
+		return *s, nil
+	}
+	return uuid.UUID{}, errors.New("offline")
+}
+
+func (n *sessionNode) Version(ctx context.Context) (api.APIVersion, error) {
+	if _, err := n.Session(ctx); err != nil {
+		return api.APIVersion{}, err
+	}
+	return api.APIVersion{}, nil
+}
+
+func TestCommandRestart(t *testing.T) {
+	before, after := uuid.New(), uuid.New()
+
+	for name, sessions := range map[string][]*uuid.UUID{
+		// the command returns once the node is back
+		"blocking": {&before, &after},
+		// the command returns while the node is still running, the export must not start on it
+		"async": {&before, &before, nil, &after},
+	} {
+		t.Run(name, func(t *testing.T) {
+			node := &sessionNode{sessions: sessions}
+
+			var phases []Phase
+			err := (&CommandRestart{Command: "true"}).Restart(context.Background(), node, func(p Phase) { phases = append(phases, p) })
+			require.NoError(t, err)
+
+			assert.Equal(t, []Phase{PhaseShuttingDown, PhaseWaitingOffline, PhaseWaitingOnline}, phases)
+			assert.Equal(t, &after, node.next())
+		})
+	}
+}
@@ -0,0 +1,488 @@
+package export
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"sort"
+	"sync"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/klauspost/compress/zstd"
+)
+
+// The seekable format stores data as independent zstd frames followed by a seek table in a skippable frame, so it
+// can be decompressed by any zstd decoder, or from any offset by a reader of the table.
+// https://github.com/facebook/zstd/blob/dev/contrib/seekable_format/zstd_seekable_compression_format.md
+const (
+	seekTableMagic     = 0x184D2A5E
+	seekableMagic      = 0x8F92EAB1
+	seekTableFooterLen = 9
+	skippableHeaderLen = 8
+	seekChecksumFlag   = 1 << 7
+	seekReservedBits   = 0x7c
+
+	// DefaultSeekableFrameSize is a frame size balancing the compression ratio with the data read for an offset
+	DefaultSeekableFrameSize = 4 << 20
+	// MaxSeekableFrameSize is the largest uncompressed frame size accepted by the writer
+	MaxSeekableFrameSize = 1 << 30
+	// maxSeekableFrames is the number of frames a seek table can describe
+	maxSeekableFrames = 1 << 27
+)
+
+var ErrNotSeekable = errors.New("not a seekable zstd stream")
+
+// SeekFrame is the location of a frame in both the compressed and decompressed stream.
+type SeekFrame struct {
+	CompressedOffset   int64
+	CompressedSize     int64
+	DecompressedOffset int64
+	DecompressedSize   int64
+	// Checksum is the lower 32 bits of the xxhash64 of the decompressed frame, when HasChecksums is set
+	Checksum uint32
+}
+
+// SeekTable lists the frames of a seekable stream.
+type SeekTable struct {
+	Frames       []SeekFrame
+	HasChecksums bool
+}
+
+// DecompressedSize is the size of the stream once decompressed.
+func (t *SeekTable) DecompressedSize() int64 {
+	if len(t.Frames) == 0 {
+		return 0
+	}
+
+	last := t.Frames[len(t.Frames)-1]
+	return last.DecompressedOffset + last.DecompressedSize
+}
+
+// FrameAt returns the index of the frame holding the decompressed offset.
+func (t *SeekTable) FrameAt(offset int64) (int, bool) {
+	i := sort.Search(len(t.Frames), func(i int) bool {
+		return t.Frames[i].DecompressedOffset+t.Frames[i].DecompressedSize > offset
+	})
+
+	return i, offset >= 0 && i < len(t.Frames)
+}
+
+// ReadSeekTable reads the seek table at the end of a seekable stream of the given size.
+func ReadSeekTable(r io.ReaderAt, size int64) (*SeekTable, error) {
+	if size < skippableHeaderLen+seekTableFooterLen {
+		return nil, ErrNotSeekable
+	}
+
+	footer := make([]byte, seekTableFooterLen)
+	if _, err := r.ReadAt(footer, size-seekTableFooterLen); err != nil {
+		return nil, fmt.Errorf("failed to read seek table footer: %w", err)
+	}
+
+	if binary.LittleEndian.Uint32(footer[5:]) != seekableMagic {
+		return nil, ErrNotSeekable
+	}
+
+	count := int64(binary.LittleEndian.Uint32(footer))
+	descriptor := footer[4]
+	if descriptor&seekReservedBits != 0 {
+		return nil, fmt.Errorf("unsupported seek table descriptor %x", descriptor)
+	}
+
+	entryLen := int64(8)
+	if descriptor&seekChecksumFlag != 0 {
+		entryLen = 12
+	}
+
+	tableLen := count*entryLen + seekTableFooterLen
+	if count > maxSeekableFrames || tableLen+skippableHeaderLen > size {
+		return nil, fmt.Errorf("seek table of %d frames does not fit in %d bytes", count, size)
+	}
+
+	table := make([]byte, skippableHeaderLen+tableLen)
+	if _, err := r.ReadAt(table, size-int64(len(table))); err != nil {
+		return nil, fmt.Errorf("failed to read seek table: %w", err)
+	}
+
+	if binary.LittleEndian.Uint32(table) != seekTableMagic || int64(binary.LittleEndian.Uint32(table[4:])) != tableLen {
+		return nil, fmt.Errorf("seek table is not in a skippable frame")
+	}
+
+	t := &SeekTable{
+		Frames:       make([]SeekFrame, count),
+		HasChecksums: descriptor&seekChecksumFlag != 0,
+	}
+
+	var compressed, decompressed int64
+	for i := range t.Frames {
+		entry := table[skippableHeaderLen+int64(i)*entryLen:]
+		f := SeekFrame{
+			CompressedOffset:   compressed,
+			CompressedSize:     int64(binary.LittleEndian.Uint32(entry)),
+			DecompressedOffset: decompressed,
+			DecompressedSize:   int64(binary.LittleEndian.Uint32(entry[4:])),
+		}
+		if t.HasChecksums {
+			f.Checksum = binary.LittleEndian.Uint32(entry[8:])
+		}
+
+		compressed += f.CompressedSize
+		decompressed += f.DecompressedSize
+		t.Frames[i] = f
+	}
+
+	if compressed != size-int64(len(table)) {
+		return nil, fmt.Errorf("seek table describes %d compressed bytes, stream has %d", compressed, size-int64(len(table)))
+	}
+
+	return t, nil
+}
+
+// SeekableWriter compresses data as independent frames of a fixed decompressed size, writing the seek table on
+// Close. Frames are compressed concurrently and written in order.
+type SeekableWriter struct {
+	w           io.Writer
+	enc         *zstd.Encoder
+	frameSize   int
+	concurrency int
+
+	buf []byte
+	// pending are the frames being compressed, oldest first
+	pending []*seekableFrame
+	// free are the frames which have been written, reused for their buffers
+	free   []*seekableFrame
+	frames []SeekFrame
+	offset int64
+	err    error
+}
+
+// seekableFrame is a frame being compressed.
+type seekableFrame struct {
+	data       []byte
+	compressed []byte
+	checksum   uint32
+	done       chan struct{}
+}
+
+// NewSeekableWriter returns a writer of frames of frameSize decompressed bytes to w, compressed with the options of
+// the encoder. Up to concurrency frames are compressed at once, 0 uses GOMAXPROCS.
+func NewSeekableWriter(w io.Writer, frameSize, concurrency int, opts ...zstd.EOption) (*SeekableWriter, error) {
+	if frameSize <= 0 || frameSize > MaxSeekableFrameSize {
+		return nil, fmt.Errorf("frame size must be between 1 and %d", MaxSeekableFrameSize)
+	}
+
+	if concurrency < 0 {
+		return nil, fmt.Errorf("concurrency must not be negative")
+	}
+	if concurrency == 0 {
+		concurrency = runtime.GOMAXPROCS(0)
+	}
+
+	// the encoder runs as many EncodeAll at once as its concurrency
+	enc, err := zstd.NewWriter(nil, append(opts, zstd.WithEncoderConcurrency(concurrency))...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SeekableWriter{
+		w:           w,
+		enc:         enc,
+		frameSize:   frameSize,
+		concurrency: concurrency,
+		buf:         make([]byte, 0, frameSize),
+	}, nil
+}
+
+func (s *SeekableWriter) Write(p []byte) (int, error) {
+	if s.err != nil {
+		return 0, s.err
+	}
+
+	n := 0
+	for len(p) > 0 {
+		c := copy(s.buf[len(s.buf):s.frameSize], p)
+		s.buf = s.buf[:len(s.buf)+c]
+		p = p[c:]
+		n += c
+
+		if len(s.buf) == s.frameSize {
+			if err := s.flush(); err != nil {
+				return n, err
+			}
+		}
+	}
+
+	return n, nil
+}
+
+// flush starts compressing the buffered data as a frame, first writing the oldest frame when concurrency frames are
+// being compressed.
+func (s *SeekableWriter) flush() error {
+	if len(s.buf) == 0 {
+		return nil
+	}
+
+	if len(s.pending) == s.concurrency {
+		if err := s.writeFrame(); err != nil {
+			return err
+		}
+	}
+
+	f := &seekableFrame{}
+	if len(s.free) > 0 {
+		f = s.free[len(s.free)-1]
+		s.free = s.free[:len(s.free)-1]
+	}
+	f.data, s.buf = s.buf, f.data[:0]
+	if cap(s.buf) < s.frameSize {
+		s.buf = make([]byte, 0, s.frameSize)
+	}
+	f.done = make(chan struct{})
+
+	go func() {
+		defer close(f.done)
+		f.compressed = s.enc.EncodeAll(f.data, f.compressed[:0])
+		f.checksum = uint32(xxhash.Sum64(f.data))
+	}()
+
+	s.pending = append(s.pending, f)
+
+	return nil
+}
+
+// writeFrame waits for the oldest frame being compressed and writes it.
+func (s *SeekableWriter) writeFrame() error {
+	f := s.pending[0]
+	<-f.done
+	s.pending = s.pending[1:]
+
+	if _, err := s.w.Write(f.compressed); err != nil {
+		s.err = err
+		return err
+	}
+
+	s.frames = append(s.frames, SeekFrame{
+		CompressedOffset: s.offset,
+		CompressedSize:   int64(len(f.compressed)),
+		DecompressedSize: int64(len(f.data)),
+		Checksum:         f.checksum,
+	})
+	s.offset += int64(len(f.compressed))
+	s.free = append(s.free, f)
+
+	return nil
+}
+
+// Close writes the remaining data and the seek table. It does not close the underlying writer.
+func (s *SeekableWriter) Close() error {
+	defer s.release()
+
+	if s.err != nil {
+		return s.err
+	}
+
+	if err := s.flush(); err != nil {
+		return err
+	}
+	for len(s.pending) > 0 {
+		if err := s.writeFrame(); err != nil {
+			return err
+		}
+	}
+
+	if len(s.frames) > maxSeekableFrames {
+		s.err = fmt.Errorf("%d frames do not fit in a seek table", len(s.frames))
+		return s.err
+	}
+
+	tableLen := len(s.frames)*12 + seekTableFooterLen
+	table := make([]byte, 0, skippableHeaderLen+tableLen)
+	table = binary.LittleEndian.AppendUint32(table, seekTableMagic)
+	table = binary.LittleEndian.AppendUint32(table, uint32(tableLen))
+	for _, f := range s.frames {
+		table = binary.LittleEndian.AppendUint32(table, uint32(f.CompressedSize))
+		table = binary.LittleEndian.AppendUint32(table, uint32(f.DecompressedSize))
+		table = binary.LittleEndian.AppendUint32(table, f.Checksum)
+	}
+	table = binary.LittleEndian.AppendUint32(table, uint32(len(s.frames)))
+	table = append(table, seekChecksumFlag)
+	table = binary.LittleEndian.AppendUint32(table, seekableMagic)
+
+	if _, err := s.w.Write(table); err != nil {
+		s.err = err
+		return err
+	}
+
+	return nil
+}
+
+// release waits for the frames being compressed and closes the encoder.
+func (s *SeekableWriter) release() {
+	for _, f := range s.pending {
+		<-f.done
+	}
+	s.pending = nil
+
+	if s.enc != nil {
+		s.enc.Close()
+		s.enc = nil
+	}
+
+	if s.err == nil {
+		s.err = errors.New("seekable writer is closed")
+	}
+}
+
+// SeekableReader reads a seekable stream from any decompressed offset, decompressing only the frames it needs.
+type SeekableReader struct {
+	r     io.ReaderAt
+	table *SeekTable
+	dec   *zstd.Decoder
+
+	mu sync.Mutex
+	// the last decompressed frame is kept for reads of the following bytes
+	frame     int
+	frameData []byte
+	offset    int64
+}
+
+// NewSeekableReader reads the seek table of the stream of the given size in r.
+func NewSeekableReader(r io.ReaderAt, size int64) (*SeekableReader, error) {
+	table, err := ReadSeekTable(r, size)
+	if err != nil {
+		return nil, err
+	}
+
+	dec, err := zstd.NewReader(nil, zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		return nil, err
+	}
+
+	return &SeekableReader{
+		r:     r,
+		table: table,
+		dec:   dec,
+		frame: -1,
+	}, nil
+}
+
+// Table returns the seek table of the stream.
+func (s *SeekableReader) Table() *SeekTable {
+	return s.table
+}
+
+// Size is the size of the stream once decompressed.
+func (s *SeekableReader) Size() int64 {
+	return s.table.DecompressedSize()
+}
+
+// readFrame returns the decompressed data of frame i, verifying its checksum. The caller must hold mu.
+func (s *SeekableReader) readFrame(i int) ([]byte, error) {
+	if s.frame == i {
+		return s.frameData, nil
+	}
+
+	f := s.table.Frames[i]
+	compressed := make([]byte, f.CompressedSize)
+	if _, err := s.r.ReadAt(compressed, f.CompressedOffset); err != nil {
+		return nil, fmt.Errorf("failed to read frame %d: %w", i, err)
+	}
+
+	// the buffer of the previous frame is reused, so it is no longer cached
+	s.frame = -1
+
+	data, err := s.dec.DecodeAll(compressed, s.frameData[:0])
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress frame %d: %w", i, err)
+	}
+
+	if int64(len(data)) != f.DecompressedSize {
+		return nil, fmt.Errorf("frame %d decompressed to %d bytes, expected %d", i, len(data), f.DecompressedSize)
+	}
+
+	if s.table.HasChecksums && uint32(xxhash.Sum64(data)) != f.Checksum {
+		return nil, fmt.Errorf("frame %d checksum mismatch", i)
+	}
+
+	s.frame = i
+	s.frameData = data
+
+	return data, nil
+}
+
+// ReadAt reads decompressed data at the offset.
+func (s *SeekableReader) ReadAt(p []byte, off int64) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.readAt(p, off)
+}
+
+func (s *SeekableReader) readAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+
+	n := 0
+	for n < len(p) {
+		i, ok := s.table.FrameAt(off + int64(n))
+		if !ok {
+			return n, io.EOF
+		}
+
+		data, err := s.readFrame(i)
+		if err != nil {
+			return n, err
+		}
+
+		n += copy(p[n:], data[off+int64(n)-s.table.Frames[i].DecompressedOffset:])
+	}
+
+	return n, nil
+}
+
+func (s *SeekableReader) Read(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.offset >= s.Size() {
+		return 0, io.EOF
+	}
+
+	n, err := s.readAt(p, s.offset)
+	s.offset += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+
+	return n, err
+}
+
+func (s *SeekableReader) Seek(offset int64, whence int) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += s.offset
+	case io.SeekEnd:
+		offset += s.Size()
+	default:
+		return 0, errors.New("invalid whence")
+	}
+
+	if offset < 0 {
+		return 0, errors.New("negative offset")
+	}
+	s.offset = offset
+
+	return offset, nil
+}
+
+// Close releases the decoder, it does not close the underlying reader.
+func (s *SeekableReader) Close() error {
+	s.dec.Close()
+	return nil
+}
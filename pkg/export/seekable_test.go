@@ -0,0 +1,163 @@
+package export
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math/rand"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func seekableData(size int) []byte {
+	rng := rand.New(rand.NewSource(1))
+	data := make([]byte, size)
+	for i := range data {
+		data[i] = byte(rng.Intn(8))
+	}
+	return data
+}
+
+func TestSeekable(t *testing.T) {
+	data := seekableData(10*1024 + 17)
+
+	var out bytes.Buffer
+	w, err := NewSeekableWriter(&out, 1024, 4, zstd.WithEncoderLevel(zstd.SpeedFastest))
+	require.NoError(t, err)
+
+	// uneven writes still produce frames of the frame size
+	for p := data; len(p) > 0; {
+		n := rand.Intn(3000) + 1
+		if n > len(p) {
+			n = len(p)
+		}
+		_, err := w.Write(p[:n])
+		require.NoError(t, err)
+		p = p[n:]
+	}
+	require.NoError(t, w.Close())
+
+	compressed := out.Bytes()
+
+	// the stream is read by any zstd decoder
+	dec, err := zstd.NewReader(bytes.NewReader(compressed))
+	require.NoError(t, err)
+	decompressed, err := io.ReadAll(dec)
+	dec.Close()
+	require.NoError(t, err)
+	assert.Equal(t, data, decompressed)
+
+	r, err := NewSeekableReader(bytes.NewReader(compressed), int64(len(compressed)))
+	require.NoError(t, err)
+	defer r.Close()
+
+	table := r.Table()
+	require.Len(t, table.Frames, 11)
+	assert.True(t, table.HasChecksums)
+	assert.Equal(t, int64(len(data)), r.Size())
+	assert.Equal(t, int64(17), table.Frames[10].DecompressedSize)
+
+	// each frame can be decompressed on its own from its compressed range
+	f := table.Frames[3]
+	frame, err := zstd.NewReader(bytes.NewReader(compressed[f.CompressedOffset : f.CompressedOffset+f.CompressedSize]))
+	require.NoError(t, err)
+	frameData, err := io.ReadAll(frame)
+	frame.Close()
+	require.NoError(t, err)
+	assert.Equal(t, data[f.DecompressedOffset:f.DecompressedOffset+f.DecompressedSize], frameData)
+
+	for _, tc := range []struct{ off, n int }{
+		{0, 10},
+		{1000, 100},
+		{1020, 2000},
+		{len(data) - 5, 5},
+		{5000, 0},
+	} {
+		p := make([]byte, tc.n)
+		n, err := r.ReadAt(p, int64(tc.off))
+		require.NoError(t, err)
+		assert.Equal(t, tc.n, n)
+		assert.Equal(t, data[tc.off:tc.off+tc.n], p)
+	}
+
+	n, err := r.ReadAt(make([]byte, 10), int64(len(data)-4))
+	assert.Equal(t, 4, n)
+	assert.Equal(t, io.EOF, err)
+
+	pos, err := r.Seek(-100, io.SeekEnd)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(data)-100), pos)
+	rest, err := io.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, data[len(data)-100:], rest)
+
+	_, err = r.Seek(2048, io.SeekStart)
+	require.NoError(t, err)
+	p := make([]byte, 64)
+	_, err = io.ReadFull(r, p)
+	require.NoError(t, err)
+	assert.Equal(t, data[2048:2048+64], p)
+}
+
+func TestSeekableInvalid(t *testing.T) {
+	var plain bytes.Buffer
+	enc, err := zstd.NewWriter(&plain)
+	require.NoError(t, err)
+	_, err = enc.Write(seekableData(4096))
+	require.NoError(t, err)
+	require.NoError(t, enc.Close())
+
+	_, err = ReadSeekTable(bytes.NewReader(plain.Bytes()), int64(plain.Len()))
+	assert.ErrorIs(t, err, ErrNotSeekable)
+
+	var out bytes.Buffer
+	w, err := NewSeekableWriter(&out, 1024, 1)
+	require.NoError(t, err)
+	_, err = w.Write(seekableData(4096))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	// a corrupted checksum is detected when the frame is read
+	corrupt := append([]byte{}, out.Bytes()...)
+	corrupt[len(corrupt)-seekTableFooterLen-1] ^= 0xff
+
+	r, err := NewSeekableReader(bytes.NewReader(corrupt), int64(len(corrupt)))
+	require.NoError(t, err)
+	defer r.Close()
+
+	_, err = r.ReadAt(make([]byte, 10), 3*1024)
+	assert.Error(t, err)
+
+	_, err = r.ReadAt(make([]byte, 10), 0)
+	assert.NoError(t, err)
+
+	// truncated streams do not match their table
+	truncated := out.Bytes()[10:]
+	_, err = ReadSeekTable(bytes.NewReader(truncated), int64(len(truncated)))
+	assert.Error(t, err)
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("disk full")
+}
+
+func TestSeekableWriterError(t *testing.T) {
+	w, err := NewSeekableWriter(failingWriter{}, 1024, 2)
+	require.NoError(t, err)
+
+	// frames are written once more than concurrency frames are pending
+	_, err = w.Write(seekableData(4096))
+	assert.EqualError(t, err, "disk full")
+
+	_, err = w.Write([]byte{1})
+	assert.Error(t, err)
+	assert.EqualError(t, w.Close(), "disk full")
+
+	_, err = NewSeekableWriter(failingWriter{}, 1024, -1)
+	assert.Error(t, err)
+}
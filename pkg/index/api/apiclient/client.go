@@ -0,0 +1,22 @@
+package apiclient
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/filecoin-project/filecoin-chain-archiver/pkg/index/api"
+	"github.com/filecoin-project/go-jsonrpc"
+)
+
+func NewOperatorClient(ctx context.Context, addr string, requestHeader http.Header, opts ...jsonrpc.Option) (api.Operator, jsonrpc.ClientCloser, error) {
+	var res api.OperatorStruct
+	closer, err := jsonrpc.NewMergeClient(ctx, addr, "Operator",
+		[]interface{}{
+			&res.Internal,
+		},
+		requestHeader,
+		opts...,
+	)
+
+	return &res, closer, err
+}
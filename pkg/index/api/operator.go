@@ -0,0 +1,90 @@
+package api
+
+import (
+	"context"
+	"time"
+
+	"github.com/filecoin-project/go-jsonrpc/auth"
+
+	"github.com/filecoin-project/filecoin-chain-archiver/pkg/index"
+)
+
+var (
+	AllPermissions = []auth.Permission{"read", "write", "admin"}
+	// DefaultPerms are given to requests without a token
+	DefaultPerms = []auth.Permission{"read"}
+)
+
+// RouteCache is the cache of a single route.
+type RouteCache struct {
+	Path    string             `json:"path"`
+	Entries []index.CacheEntry `json:"entries"`
+}
+
+// Resolved is the value a route currently serves.
+type Resolved struct {
+	Path     string    `json:"path"`
+	Key      string    `json:"key"`
+	Resolver string    `json:"resolver"`
+	Value    string    `json:"value,omitempty"`
+	Expiry   time.Time `json:"expiry,omitempty"`
+	Error    string    `json:"error,omitempty"`
+}
+
+type Operator interface {
+	Version(context.Context) (string, error)           //perm:read
+	LogList(context.Context) ([]string, error)         //perm:write
+	LogSetLevel(context.Context, string, string) error //perm:write
+
+	CacheList(context.Context) ([]RouteCache, error)      //perm:read
+	CacheFlush(context.Context) error                     //perm:admin
+	CacheInvalidate(context.Context, string) error        //perm:admin
+	CacheRefresh(context.Context, string) (string, error) //perm:admin
+	Resolved(context.Context) ([]Resolved, error)         //perm:read
+}
+
+type OperatorStruct struct {
+	Internal struct {
+		Version     func(p0 context.Context) (string, error)             `perm:"read"`
+		LogList     func(p0 context.Context) ([]string, error)           `perm:"write"`
+		LogSetLevel func(p0 context.Context, p1 string, p2 string) error `perm:"write"`
+
+		CacheList       func(p0 context.Context) ([]RouteCache, error)      `perm:"read"`
+		CacheFlush      func(p0 context.Context) error                      `perm:"admin"`
+		CacheInvalidate func(p0 context.Context, p1 string) error           `perm:"admin"`
+		CacheRefresh    func(p0 context.Context, p1 string) (string, error) `perm:"admin"`
+		Resolved        func(p0 context.Context) ([]Resolved, error)        `perm:"read"`
+	}
+}
+
+func (s *OperatorStruct) Version(p0 context.Context) (string, error) {
+	return s.Internal.Version(p0)
+}
+
+func (s *OperatorStruct) LogList(p0 context.Context) ([]string, error) {
+	return s.Internal.LogList(p0)
+}
+
+func (s *OperatorStruct) LogSetLevel(p0 context.Context, p1 string, p2 string) error {
+	return s.Internal.LogSetLevel(p0, p1, p2)
+}
+
+func (s *OperatorStruct) CacheList(p0 context.Context) ([]RouteCache, error) {
+	return s.Internal.CacheList(p0)
+}
+
+func (s *OperatorStruct) CacheFlush(p0 context.Context) error {
+	return s.Internal.CacheFlush(p0)
+}
+
+func (s *OperatorStruct) CacheInvalidate(p0 context.Context, p1 string) error {
+	return s.Internal.CacheInvalidate(p0, p1)
+}
+
+func (s *OperatorStruct) CacheRefresh(p0 context.Context, p1 string) (string, error) {
+	return s.Internal.CacheRefresh(p0, p1)
+}
+
+func (s *OperatorStruct) Resolved(p0 context.Context) ([]Resolved, error) {
+	return s.Internal.Resolved(p0)
+}
@@ -0,0 +1,222 @@
+package index
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// refreshTimeout bounds fetches from the backend, which are shared by every caller waiting on them
+const refreshTimeout = 30 * time.Second
+
+type cacheMetadata struct {
+	key    string
+	value  interface{}
+	expiry time.Time
+	// fetched is when the fetch of the value started, fetches started earlier do not replace it
+	fetched time.Time
+	// removed marks an invalidated value, it is kept so fetches started before the invalidation do not cache again
+	removed bool
+}
+
+// staleCache is an LRU of values fetched from a backend. Concurrent fetches of a key are collapsed into one, and
+// values past their TTL are served while they are fetched again in the background, or when fetching fails, until
+// MaxStale runs out.
+type staleCache struct {
+	opts CacheOptions
+
+	group singleflight.Group
+
+	cacheMu sync.Mutex
+	cache   map[string]*list.Element
+	lru     list.List
+	// fetching counts the fetches in flight of each key, invalidating a key which is being fetched must keep the
+	// fetch from caching
+	fetching map[string]int
+	// flushed is when the cache was last flushed, fetches started before are not cached
+	flushed time.Time
+}
+
+// fetchFunc fetches the value of a key from the backend.
+type fetchFunc func(ctx context.Context) (interface{}, error)
+
+func newStaleCache(opts CacheOptions) *staleCache {
+	return &staleCache{
+		opts:     opts,
+		cache:    make(map[string]*list.Element),
+		fetching: make(map[string]int),
+	}
+}
+
+func (c *staleCache) read(key string) (cacheMetadata, bool) {
+	c.cacheMu.Lock()
+	defer c.cacheMu.Unlock()
+	if e, ok := c.cache[key]; ok {
+		v := e.Value.(cacheMetadata)
+		if v.removed {
+			return cacheMetadata{}, false
+		}
+
+		c.lru.MoveToFront(e)
+		return v, true
+	}
+
+	return cacheMetadata{}, false
+}
+
+// set caches v unless the cache was flushed, or key was set or invalidated, after v was fetched. The caller must
+// hold cacheMu.
+func (c *staleCache) set(v cacheMetadata) {
+	if v.fetched.Before(c.flushed) {
+		return
+	}
+
+	if e, ok := c.cache[v.key]; ok {
+		if v.fetched.Before(e.Value.(cacheMetadata).fetched) {
+			logger.Debugw("cache ignored older value", "key", v.key)
+			return
+		}
+
+		e.Value = v
+		c.lru.MoveToFront(e)
+		return
+	}
+
+	c.cache[v.key] = c.lru.PushFront(v)
+
+	for c.opts.MaxEntries > 0 && c.lru.Len() > c.opts.MaxEntries {
+		e := c.lru.Back()
+		c.lru.Remove(e)
+		delete(c.cache, e.Value.(cacheMetadata).key)
+		logger.Debugw("cache evicted", "key", e.Value.(cacheMetadata).key)
+	}
+}
+
+// fetch fetches key from the backend, collapsing concurrent calls for the same key into one. The backend call runs
+// on its own context, so callers giving up do not fail the others waiting on it.
+func (c *staleCache) fetch(ctx context.Context, key string, fn fetchFunc) (interface{}, error) {
+	ch := c.group.DoChan(key, func() (interface{}, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), refreshTimeout)
+		defer cancel()
+
+		c.cacheMu.Lock()
+		c.fetching[key]++
+		fetched := time.Now()
+		c.cacheMu.Unlock()
+
+		value, err := fn(ctx)
+
+		c.cacheMu.Lock()
+		defer c.cacheMu.Unlock()
+
+		if c.fetching[key]--; c.fetching[key] == 0 {
+			delete(c.fetching, key)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		c.set(cacheMetadata{
+			key:     key,
+			value:   value,
+			expiry:  time.Now().Add(c.opts.TTL),
+			fetched: fetched,
+		})
+
+		return value, nil
+	})
+
+	select {
+	case res := <-ch:
+		return res.Val, res.Err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (c *staleCache) refresh(key string, fn fetchFunc) {
+	go func() {
+		if _, err := c.fetch(context.Background(), key, fn); err != nil {
+			logger.Warnw("failed to refresh, serving stale value", "key", key, "err", err)
+		}
+	}()
+}
+
+// get returns the cached value of key, fetching it when it is missing or older than MaxStale.
+func (c *staleCache) get(ctx context.Context, key string, fn fetchFunc) (interface{}, error) {
+	now := time.Now()
+	v, ok := c.read(key)
+	switch {
+	case ok && now.Before(v.expiry):
+		logger.Debugw("cache hit", "key", key)
+		return v.value, nil
+	case ok && now.Before(v.expiry.Add(c.opts.MaxStale)):
+		logger.Debugw("cache stale", "key", key)
+		c.refresh(key, fn)
+		return v.value, nil
+	}
+
+	logger.Debugw("cache miss", "key", key)
+	return c.fetch(ctx, key, fn)
+}
+
+// reload fetches key from the backend and replaces the cached value.
+func (c *staleCache) reload(ctx context.Context, key string, fn fetchFunc) (interface{}, error) {
+	// an in flight fetch may have started before the value changed, it is not waited on and does not replace the
+	// value fetched here as it started earlier
+	c.group.Forget(key)
+	return c.fetch(ctx, key, fn)
+}
+
+// invalidate removes key from the cache, reporting if it was cached.
+func (c *staleCache) invalidate(key string) bool {
+	// later callers do not wait on a fetch started before the invalidation
+	c.group.Forget(key)
+
+	c.cacheMu.Lock()
+	defer c.cacheMu.Unlock()
+
+	e, ok := c.cache[key]
+	if !ok && c.fetching[key] == 0 {
+		// nothing to remove, a tombstone would only take the place of cached values
+		return false
+	}
+	ok = ok && !e.Value.(cacheMetadata).removed
+
+	c.set(cacheMetadata{
+		key:     key,
+		fetched: time.Now(),
+		removed: true,
+	})
+
+	return ok
+}
+
+// flush removes every value from the cache.
+func (c *staleCache) flush() {
+	c.cacheMu.Lock()
+	defer c.cacheMu.Unlock()
+
+	c.cache = make(map[string]*list.Element)
+	c.lru.Init()
+	c.flushed = time.Now()
+}
+
+// entries returns the cached values, most recently used first.
+func (c *staleCache) entries() []cacheMetadata {
+	c.cacheMu.Lock()
+	defer c.cacheMu.Unlock()
+
+	entries := make([]cacheMetadata, 0, c.lru.Len())
+	for e := c.lru.Front(); e != nil; e = e.Next() {
+		if v := e.Value.(cacheMetadata); !v.removed {
+			entries = append(entries, v)
+		}
+	}
+
+	return entries
+}
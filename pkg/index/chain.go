@@ -0,0 +1,93 @@
+package index
+
+import (
+	"context"
+	"errors"
+
+	"golang.org/x/xerrors"
+)
+
+// ChainResolver tries each resolver in order, returning the first value resolved.
+type ChainResolver struct {
+	resolvers []Resolver
+}
+
+func NewChainResolver(resolvers ...Resolver) *ChainResolver {
+	return &ChainResolver{
+		resolvers: resolvers,
+	}
+}
+
+func (c *ChainResolver) Resolve(ctx context.Context, obj string) (string, error) {
+	var err error
+	for i, r := range c.resolvers {
+		var value string
+		value, err = r.Resolve(ctx, obj)
+		if err == nil {
+			return value, nil
+		}
+
+		logger.Warnw("resolver failed, trying next", "key", obj, "resolver", i, "err", err)
+	}
+
+	return "", xerrors.Errorf("all %d resolvers failed, last error: %w", len(c.resolvers), err)
+}
+
+// ChainLister tries each lister in order, returning the first listing.
+type ChainLister struct {
+	listers []Lister
+}
+
+func NewChainLister(listers ...Lister) *ChainLister {
+	return &ChainLister{
+		listers: listers,
+	}
+}
+
+func (c *ChainLister) List(ctx context.Context, prefix string) ([]Snapshot, error) {
+	var err error
+	for i, l := range c.listers {
+		var snapshots []Snapshot
+		snapshots, err = l.List(ctx, prefix)
+		if err == nil {
+			return snapshots, nil
+		}
+
+		logger.Warnw("lister failed, trying next", "prefix", prefix, "lister", i, "err", err)
+	}
+
+	return nil, xerrors.Errorf("all %d listers failed, last error: %w", len(c.listers), err)
+}
+
+// ChainObjectStore tries each store in order, returning the first object found.
+type ChainObjectStore struct {
+	stores []ObjectStore
+}
+
+func NewChainObjectStore(stores ...ObjectStore) *ChainObjectStore {
+	return &ChainObjectStore{
+		stores: stores,
+	}
+}
+
+func (c *ChainObjectStore) Open(ctx context.Context, key string) (*Object, error) {
+	// the object is only reported missing when no store failed for another reason
+	var failed error
+	for i, s := range c.stores {
+		object, err := s.Open(ctx, key)
+		if err == nil {
+			return object, nil
+		}
+
+		if !errors.Is(err, ErrObjectNotFound) {
+			failed = err
+			logger.Warnw("object store failed, trying next", "key", key, "store", i, "err", err)
+		}
+	}
+
+	if failed != nil {
+		return nil, xerrors.Errorf("all %d object stores failed, last error: %w", len(c.stores), failed)
+	}
+
+	return nil, ErrObjectNotFound
+}
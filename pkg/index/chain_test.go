@@ -0,0 +1,92 @@
+package index
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeFile(t *testing.T, root, name, data string) {
+	p := filepath.Join(root, filepath.FromSlash(name))
+	require.NoError(t, os.MkdirAll(filepath.Dir(p), 0755))
+	require.NoError(t, os.WriteFile(p, []byte(data), 0644))
+}
+
+func TestFilesystemBackend(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, root, "minimal/latest", "https://example.com/minimal/1200_2020_08_25T22_00_00Z.car.zst\n")
+	writeFile(t, root, "minimal/1200_2020_08_25T22_00_00Z.car.zst", "snapshot")
+	writeFile(t, root, "minimal/1200_2020_08_25T22_00_00Z.sha256sum", "abcd  1200_2020_08_25T22_00_00Z.car.zst\n")
+	writeFile(t, root, "minimal/1100_2020_08_25T21_00_00Z.car.zst", "older")
+	writeFile(t, root, "secret", "outside")
+
+	v, err := NewIndexFSResolver(root).Resolve(context.Background(), "minimal/latest")
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com/minimal/1200_2020_08_25T22_00_00Z.car.zst", v)
+
+	// keys can not escape the root
+	_, err = NewIndexFSResolver(filepath.Join(root, "minimal")).Resolve(context.Background(), "../secret")
+	assert.Error(t, err)
+
+	snapshots, err := NewIndexFSLister(root, "https://example.com/").List(context.Background(), "minimal/")
+	require.NoError(t, err)
+	require.Len(t, snapshots, 2)
+	assert.Equal(t, "minimal/1200_2020_08_25T22_00_00Z.car.zst", snapshots[0].Key)
+	assert.Equal(t, "abcd", snapshots[0].Digest)
+	assert.Equal(t, int64(8), snapshots[0].Size)
+	assert.Equal(t, "https://example.com/minimal/1200_2020_08_25T22_00_00Z.car.zst", snapshots[0].URL)
+	assert.Equal(t, int64(1100), snapshots[1].Height)
+
+	object, err := NewIndexFSObjectStore(root).Open(context.Background(), snapshots[1].Key)
+	require.NoError(t, err)
+	data, err := io.ReadAll(object)
+	require.NoError(t, err)
+	assert.Equal(t, "older", string(data))
+	require.NoError(t, object.Close())
+
+	_, err = NewIndexFSObjectStore(root).Open(context.Background(), "minimal/missing.car.zst")
+	assert.ErrorIs(t, err, ErrObjectNotFound)
+}
+
+type failingResolver struct{}
+
+func (failingResolver) Resolve(context.Context, string) (string, error) {
+	return "", errors.New("unavailable")
+}
+
+type failingObjectStore struct{}
+
+func (failingObjectStore) Open(context.Context, string) (*Object, error) {
+	return nil, errors.New("unavailable")
+}
+
+func TestChain(t *testing.T) {
+	primary, mirror := t.TempDir(), t.TempDir()
+	writeFile(t, mirror, "minimal/latest", "mirror")
+	writeFile(t, mirror, "minimal/a.car.zst", "a")
+
+	v, err := NewChainResolver(failingResolver{}, NewIndexFSResolver(primary), NewIndexFSResolver(mirror)).Resolve(context.Background(), "minimal/latest")
+	require.NoError(t, err)
+	assert.Equal(t, "mirror", v)
+
+	_, err = NewChainResolver(failingResolver{}, NewIndexFSResolver(primary)).Resolve(context.Background(), "minimal/latest")
+	assert.Error(t, err)
+
+	object, err := NewChainObjectStore(NewIndexFSObjectStore(primary), NewIndexFSObjectStore(mirror)).Open(context.Background(), "minimal/a.car.zst")
+	require.NoError(t, err)
+	object.Close()
+
+	// missing objects are only reported as missing when every store could be asked
+	_, err = NewChainObjectStore(NewIndexFSObjectStore(primary), NewIndexFSObjectStore(mirror)).Open(context.Background(), "minimal/b.car.zst")
+	assert.ErrorIs(t, err, ErrObjectNotFound)
+
+	_, err = NewChainObjectStore(failingObjectStore{}, NewIndexFSObjectStore(mirror)).Open(context.Background(), "minimal/b.car.zst")
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, ErrObjectNotFound)
+}
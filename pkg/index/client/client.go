@@ -0,0 +1,113 @@
+// Package client reads snapshot metadata from the index resolver service.
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/filecoin-project/filecoin-chain-archiver/pkg/index"
+)
+
+// maxErrorSize bounds how much of an error response is read
+const maxErrorSize = 4096
+
+type Client struct {
+	endpoint string
+	client   *http.Client
+	token    string
+}
+
+type Option func(*Client)
+
+// WithHTTPClient sets the client used for requests, http.DefaultClient is used otherwise.
+func WithHTTPClient(client *http.Client) Option {
+	return func(c *Client) {
+		c.client = client
+	}
+}
+
+// WithToken sets the token sent to routes which require one.
+func WithToken(token string) Option {
+	return func(c *Client) {
+		c.token = token
+	}
+}
+
+// NewClient returns a client of the service at endpoint, eg: https://snapshots.example.com
+func NewClient(endpoint string, opts ...Option) *Client {
+	c := &Client{
+		endpoint: endpoint,
+		client:   http.DefaultClient,
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+// Latest describes the latest snapshot served on path, eg: /minimal/latest. The URL of the snapshot is where it can
+// be downloaded from.
+func (c *Client) Latest(ctx context.Context, path string) (index.Snapshot, error) {
+	var snapshot index.Snapshot
+	if err := c.get(ctx, path, nil, &snapshot); err != nil {
+		return index.Snapshot{}, err
+	}
+
+	return snapshot, nil
+}
+
+// Snapshots lists the snapshots under base, eg: /minimal. The query holds the pagination and filters of the listing,
+// such as limit, offset and min_height.
+func (c *Client) Snapshots(ctx context.Context, base string, query url.Values) (index.SnapshotList, error) {
+	var list index.SnapshotList
+	if err := c.get(ctx, strings.TrimSuffix(base, "/")+"/snapshots", query, &list); err != nil {
+		return index.SnapshotList{}, err
+	}
+
+	return list, nil
+}
+
+func (c *Client) get(ctx context.Context, path string, query url.Values, v interface{}) error {
+	u, err := url.JoinPath(c.endpoint, path)
+	if err != nil {
+		return err
+	}
+
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Accept", "application/json")
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorSize))
+		return fmt.Errorf("%s: unexpected status %d: %s", u, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("%s: failed to decode response: %w", u, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,82 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/filecoin-chain-archiver/pkg/index/service"
+)
+
+func TestClient(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"minimal/latest": "https://example.com/minimal/1200_2020_08_25T22_00_00Z.car.zst",
+		"minimal/1200_2020_08_25T22_00_00Z.car.zst":   "snapshot",
+		"minimal/1200_2020_08_25T22_00_00Z.sha256sum": "abcd  1200_2020_08_25T22_00_00Z.car.zst\n",
+		"minimal/1100_2020_08_25T21_00_00Z.car.zst":   "older",
+	}
+	for name, data := range files {
+		p := filepath.Join(root, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0755))
+		require.NoError(t, os.WriteFile(p, []byte(data), 0644))
+	}
+
+	cfgPath := filepath.Join(t.TempDir(), "config.toml")
+	require.NoError(t, os.WriteFile(cfgPath, []byte(fmt.Sprintf(`
+[[Resolvers]]
+  Name = "local"
+  Type = "fs"
+  [Resolvers.Filesystem]
+    Path = %q
+    RetrievalEndpointPrefix = "https://example.com/"
+
+[[Routes]]
+  Path = "/minimal/latest"
+  Resolver = "local"
+  Key = "minimal/latest"
+`, root)), 0644))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s := service.NewIndexService(ctx)
+	require.NoError(t, s.SetupService(cfgPath))
+
+	srv := httptest.NewServer(s.ServiceRouter)
+	defer srv.Close()
+
+	c := NewClient(srv.URL)
+
+	latest, err := c.Latest(ctx, "/minimal/latest")
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com/minimal/1200_2020_08_25T22_00_00Z.car.zst", latest.URL)
+	assert.Equal(t, int64(1200), latest.Height)
+	assert.Equal(t, int64(8), latest.Size)
+	assert.Equal(t, "abcd", latest.Digest)
+
+	list, err := c.Snapshots(ctx, "/minimal", url.Values{"limit": {"1"}})
+	require.NoError(t, err)
+	assert.Equal(t, 2, list.Total)
+	require.Len(t, list.Snapshots, 1)
+	require.NotNil(t, list.NextOffset)
+
+	_, err = c.Latest(ctx, "/missing/latest")
+	assert.Error(t, err)
+
+	// clients which do not ask for json are redirected
+	noRedirect := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := noRedirect.Get(srv.URL + "/minimal/latest")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusFound, resp.StatusCode)
+	assert.Equal(t, latest.URL, resp.Header.Get("Location"))
+}
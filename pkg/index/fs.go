@@ -0,0 +1,161 @@
+package index
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/xerrors"
+)
+
+// fsPath returns the path of the object key under root. Keys are cleaned as absolute paths first so they can not
+// refer to files outside of root.
+func fsPath(root, key string) string {
+	return filepath.Join(root, filepath.FromSlash(path.Clean("/"+key)))
+}
+
+// IndexFSResolver resolves objects from pointer files stored under a local directory, laid out the same as the
+// bucket, eg: <root>/minimal/latest
+type IndexFSResolver struct {
+	root string
+}
+
+func NewIndexFSResolver(root string) *IndexFSResolver {
+	return &IndexFSResolver{
+		root: root,
+	}
+}
+
+func (i *IndexFSResolver) Resolve(ctx context.Context, obj string) (string, error) {
+	data, err := os.ReadFile(fsPath(i.root, obj))
+	if err != nil {
+		return "", xerrors.Errorf("failed to resolve link: %w", err)
+	}
+
+	logger.Infow("resolved", "link", string(data))
+
+	return strings.TrimSpace(string(data)), nil
+}
+
+// IndexFSLister lists snapshots stored under a local directory.
+type IndexFSLister struct {
+	root            string
+	retrievalPrefix string
+}
+
+func NewIndexFSLister(root, retrievalPrefix string) *IndexFSLister {
+	return &IndexFSLister{
+		root:            root,
+		retrievalPrefix: retrievalPrefix,
+	}
+}
+
+func (i *IndexFSLister) List(ctx context.Context, prefix string) ([]Snapshot, error) {
+	dir := fsPath(i.root, prefix)
+	// prefixes name a directory, eg: minimal/, or a partial filename within one
+	if !strings.HasSuffix(prefix, "/") && prefix != "" {
+		dir = filepath.Dir(dir)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return []Snapshot{}, nil
+		}
+		return nil, xerrors.Errorf("failed to list snapshots: %w", err)
+	}
+
+	keyDir := path.Dir(prefix + "x")
+
+	snapshots := []Snapshot{}
+	for _, entry := range entries {
+		key := path.Join(keyDir, entry.Name())
+		if entry.IsDir() || !strings.HasPrefix(key, prefix) || !strings.HasSuffix(key, SnapshotSuffix) {
+			continue
+		}
+
+		height, t, ok := ParseSnapshotName(entry.Name())
+		if !ok {
+			logger.Debugw("skipping file", "key", key)
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return nil, xerrors.Errorf("failed to list snapshots: %w", err)
+		}
+
+		s := Snapshot{
+			Name:      strings.TrimSuffix(entry.Name(), SnapshotSuffix),
+			Key:       key,
+			Height:    height,
+			Timestamp: t,
+			Size:      info.Size(),
+		}
+
+		if data, err := os.ReadFile(filepath.Join(dir, s.Name+ChecksumSuffix)); err == nil {
+			s.Digest, _ = ParseChecksum(string(data), entry.Name())
+		}
+
+		if i.retrievalPrefix != "" {
+			u, err := url.JoinPath(i.retrievalPrefix, key)
+			if err != nil {
+				return nil, xerrors.Errorf("failed to join retrieval url: %w", err)
+			}
+			s.URL = u
+		}
+
+		snapshots = append(snapshots, s)
+	}
+
+	SortSnapshots(snapshots)
+
+	return snapshots, nil
+}
+
+// IndexFSObjectStore opens objects stored under a local directory.
+type IndexFSObjectStore struct {
+	root string
+}
+
+func NewIndexFSObjectStore(root string) *IndexFSObjectStore {
+	return &IndexFSObjectStore{
+		root: root,
+	}
+}
+
+func (i *IndexFSObjectStore) Open(ctx context.Context, key string) (*Object, error) {
+	f, err := os.Open(fsPath(i.root, key))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, ErrObjectNotFound
+		}
+		return nil, xerrors.Errorf("failed to open object: %w", err)
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, xerrors.Errorf("failed to stat object: %w", err)
+	}
+
+	if info.IsDir() {
+		f.Close()
+		return nil, ErrObjectNotFound
+	}
+
+	return &Object{
+		ReadSeekCloser: f,
+		Key:            key,
+		Size:           info.Size(),
+		// files have no etag, so one is derived from what identifies the version of the file
+		ETag:    fmt.Sprintf("%x-%x", info.ModTime().UnixNano(), info.Size()),
+		ModTime: info.ModTime(),
+	}, nil
+}
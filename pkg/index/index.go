@@ -4,7 +4,6 @@ import (
 	"context"
 	"io"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/ipfs/go-log/v2"
@@ -12,10 +11,6 @@ import (
 	"golang.org/x/xerrors"
 )
 
-var (
-	expiryLength = 5 * time.Minute
-)
-
 var logger = log.Logger("filecoin-chain-archiver/pkg/index-resolver")
 
 type IndexS3Resolver struct {
@@ -54,59 +49,92 @@ func (i *IndexS3Resolver) Resolve(ctx context.Context, obj string) (string, erro
 	return strings.TrimSpace(string(data)), nil
 }
 
-type cacheMetadata struct {
-	value  string
-	expiry time.Time
+// CacheOptions control how long resolved values are kept by a CachedResolver.
+type CacheOptions struct {
+	// TTL is how long a value is served before it is refreshed
+	TTL time.Duration
+	// MaxStale is how long past the TTL a value may still be served, while it is refreshed in the background or
+	// when refreshing fails
+	MaxStale time.Duration
+	// MaxEntries bounds the number of cached values, the least recently used are evicted first
+	MaxEntries int
+}
+
+func DefaultCacheOptions() CacheOptions {
+	return CacheOptions{
+		TTL:        5 * time.Minute,
+		MaxStale:   time.Hour,
+		MaxEntries: 1024,
+	}
 }
 
 type CachedResolver struct {
 	resolver Resolver
-
-	cacheMu sync.Mutex
-	cache   map[string]cacheMetadata
+	cache    *staleCache
 }
 
-func NewCachedResolver(resolver Resolver) *CachedResolver {
+func NewCachedResolver(resolver Resolver, opts CacheOptions) *CachedResolver {
 	return &CachedResolver{
 		resolver: resolver,
-		cache:    make(map[string]cacheMetadata),
+		cache:    newStaleCache(opts),
 	}
 }
 
-func (i *CachedResolver) read(obj string) (string, bool) {
-	i.cacheMu.Lock()
-	defer i.cacheMu.Unlock()
-	if v, ok := i.cache[obj]; ok {
-		if time.Now().Before(v.expiry) {
-			return v.value, true
-		}
+func (i *CachedResolver) fetchFunc(obj string) fetchFunc {
+	return func(ctx context.Context) (interface{}, error) {
+		return i.resolver.Resolve(ctx, obj)
 	}
+}
 
-	return "", false
+// Invalidate removes obj from the cache, reporting if it was cached.
+func (i *CachedResolver) Invalidate(obj string) bool {
+	return i.cache.invalidate(obj)
 }
 
-func (i *CachedResolver) set(obj, value string, expiry time.Time) {
-	i.cacheMu.Lock()
-	defer i.cacheMu.Unlock()
-	i.cache[obj] = cacheMetadata{
-		expiry: expiry,
-		value:  value,
-	}
+// Flush removes every value from the cache.
+func (i *CachedResolver) Flush() {
+	i.cache.flush()
 }
 
-func (i *CachedResolver) Resolve(ctx context.Context, obj string) (string, error) {
-	if v, ok := i.read(obj); ok {
-		logger.Debugw("cache hit")
-		return v, nil
+// CacheEntry describes a cached value.
+type CacheEntry struct {
+	Key    string    `json:"key"`
+	Value  string    `json:"value"`
+	Expiry time.Time `json:"expiry"`
+}
+
+// Entries returns the cached values, most recently used first. Expired values which are still within MaxStale are
+// included.
+func (i *CachedResolver) Entries() []CacheEntry {
+	cached := i.cache.entries()
+
+	entries := make([]CacheEntry, 0, len(cached))
+	for _, v := range cached {
+		entries = append(entries, CacheEntry{
+			Key:    v.key,
+			Value:  v.value.(string),
+			Expiry: v.expiry,
+		})
 	}
 
-	value, err := i.resolver.Resolve(ctx, obj)
+	return entries
+}
+
+// Refresh resolves obj from the backing resolver and replaces the cached value.
+func (i *CachedResolver) Refresh(ctx context.Context, obj string) (string, error) {
+	v, err := i.cache.reload(ctx, obj, i.fetchFunc(obj))
 	if err != nil {
 		return "", err
 	}
 
-	logger.Debugw("cache miss")
-	i.set(obj, value, time.Now().Add(expiryLength))
+	return v.(string), nil
+}
+
+func (i *CachedResolver) Resolve(ctx context.Context, obj string) (string, error) {
+	v, err := i.cache.get(ctx, obj, i.fetchFunc(obj))
+	if err != nil {
+		return "", err
+	}
 
-	return value, nil
+	return v.(string), nil
 }
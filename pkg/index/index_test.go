@@ -0,0 +1,250 @@
+package index
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type countingResolver struct {
+	calls int32
+	delay time.Duration
+	err   error
+	errMu sync.Mutex
+}
+
+func (r *countingResolver) setErr(err error) {
+	r.errMu.Lock()
+	defer r.errMu.Unlock()
+	r.err = err
+}
+
+func (r *countingResolver) Resolve(ctx context.Context, obj string) (string, error) {
+	n := atomic.AddInt32(&r.calls, 1)
+	time.Sleep(r.delay)
+
+	r.errMu.Lock()
+	defer r.errMu.Unlock()
+	if r.err != nil {
+		return "", r.err
+	}
+
+	return fmt.Sprintf("%s-%d", obj, n), nil
+}
+
+func TestCachedResolverSingleflight(t *testing.T) {
+	backend := &countingResolver{delay: 50 * time.Millisecond}
+	cr := NewCachedResolver(backend, DefaultCacheOptions())
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, err := cr.Resolve(context.Background(), "minimal/latest")
+			assert.NoError(t, err)
+			assert.Equal(t, "minimal/latest-1", v)
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&backend.calls))
+}
+
+func TestCachedResolverStale(t *testing.T) {
+	backend := &countingResolver{}
+	cr := NewCachedResolver(backend, CacheOptions{TTL: 20 * time.Millisecond, MaxStale: 100 * time.Millisecond})
+
+	v, err := cr.Resolve(context.Background(), "latest")
+	require.NoError(t, err)
+	assert.Equal(t, "latest-1", v)
+
+	// stale values are served while refreshing in the background
+	time.Sleep(30 * time.Millisecond)
+	v, err = cr.Resolve(context.Background(), "latest")
+	require.NoError(t, err)
+	assert.Equal(t, "latest-1", v)
+
+	require.Eventually(t, func() bool {
+		v, _ := cr.Resolve(context.Background(), "latest")
+		return v == "latest-2"
+	}, time.Second, 5*time.Millisecond)
+
+	// stale values are kept when the backend fails
+	backend.setErr(errors.New("unavailable"))
+	time.Sleep(30 * time.Millisecond)
+	v, err = cr.Resolve(context.Background(), "latest")
+	require.NoError(t, err)
+	assert.Equal(t, "latest-2", v)
+
+	// until they are older than max stale
+	time.Sleep(150 * time.Millisecond)
+	_, err = cr.Resolve(context.Background(), "latest")
+	assert.Error(t, err)
+}
+
+func TestCachedResolverEviction(t *testing.T) {
+	backend := &countingResolver{}
+	cr := NewCachedResolver(backend, CacheOptions{TTL: time.Minute, MaxEntries: 2})
+
+	for _, key := range []string{"a", "b", "a", "c"} {
+		_, err := cr.Resolve(context.Background(), key)
+		require.NoError(t, err)
+	}
+
+	// b was the least recently used when c was added
+	assert.Equal(t, int32(3), atomic.LoadInt32(&backend.calls))
+
+	v, err := cr.Resolve(context.Background(), "a")
+	require.NoError(t, err)
+	assert.Equal(t, "a-1", v)
+
+	v, err = cr.Resolve(context.Background(), "b")
+	require.NoError(t, err)
+	assert.Equal(t, "b-4", v)
+
+	// invalidating keys which are not cached does not evict the cached ones
+	for _, key := range []string{"x", "y", "z"} {
+		assert.False(t, cr.Invalidate(key))
+	}
+	for _, key := range []string{"a", "b"} {
+		_, err := cr.Resolve(context.Background(), key)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, int32(4), atomic.LoadInt32(&backend.calls))
+}
+
+func TestCachedResolverInvalidate(t *testing.T) {
+	backend := &countingResolver{}
+	cr := NewCachedResolver(backend, CacheOptions{TTL: time.Minute})
+
+	v, err := cr.Resolve(context.Background(), "latest")
+	require.NoError(t, err)
+	assert.Equal(t, "latest-1", v)
+
+	assert.True(t, cr.Invalidate("latest"))
+	assert.False(t, cr.Invalidate("latest"))
+
+	v, err = cr.Resolve(context.Background(), "latest")
+	require.NoError(t, err)
+	assert.Equal(t, "latest-2", v)
+
+	// refresh replaces the cached value even before it expires
+	v, err = cr.Refresh(context.Background(), "latest")
+	require.NoError(t, err)
+	assert.Equal(t, "latest-3", v)
+
+	v, err = cr.Resolve(context.Background(), "latest")
+	require.NoError(t, err)
+	assert.Equal(t, "latest-3", v)
+}
+
+func TestCachedResolverCallerCanceled(t *testing.T) {
+	backend := &countingResolver{delay: 50 * time.Millisecond}
+	cr := NewCachedResolver(backend, DefaultCacheOptions())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error)
+	go func() {
+		_, err := cr.Resolve(ctx, "latest")
+		errc <- err
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+
+	// the first caller going away does not fail the others waiting on the same fetch
+	v, err := cr.Resolve(context.Background(), "latest")
+	require.NoError(t, err)
+	assert.Equal(t, "latest-1", v)
+	assert.ErrorIs(t, <-errc, context.Canceled)
+
+	v, err = cr.Resolve(context.Background(), "latest")
+	require.NoError(t, err)
+	assert.Equal(t, "latest-1", v)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&backend.calls))
+}
+
+// gatedResolver returns the values it is sent, in the order the calls are made.
+type gatedResolver struct {
+	calls chan chan string
+}
+
+func (r *gatedResolver) Resolve(ctx context.Context, obj string) (string, error) {
+	c := make(chan string)
+	r.calls <- c
+	return <-c, nil
+}
+
+func TestCachedResolverRefreshOrdering(t *testing.T) {
+	backend := &gatedResolver{calls: make(chan chan string)}
+	cr := NewCachedResolver(backend, DefaultCacheOptions())
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		v, err := cr.Resolve(context.Background(), "latest")
+		assert.NoError(t, err)
+		assert.Equal(t, "old", v)
+	}()
+	first := <-backend.calls
+
+	go func() {
+		(<-backend.calls) <- "new"
+	}()
+	v, err := cr.Refresh(context.Background(), "latest")
+	require.NoError(t, err)
+	assert.Equal(t, "new", v)
+
+	// the fetch which started before the refresh finishes last and is not cached
+	first <- "old"
+	<-done
+
+	v, err = cr.Resolve(context.Background(), "latest")
+	require.NoError(t, err)
+	assert.Equal(t, "new", v)
+
+	// neither is a fetch started before an invalidation
+	go func() {
+		v, err := cr.Refresh(context.Background(), "latest")
+		assert.NoError(t, err)
+		assert.Equal(t, "older", v)
+	}()
+	pending := <-backend.calls
+	assert.True(t, cr.Invalidate("latest"))
+	pending <- "older"
+
+	go func() {
+		(<-backend.calls) <- "newest"
+	}()
+	v, err = cr.Resolve(context.Background(), "latest")
+	require.NoError(t, err)
+	assert.Equal(t, "newest", v)
+
+	// or an invalidation of a key which was not cached yet
+	go func() {
+		v, err := cr.Resolve(context.Background(), "other")
+		assert.NoError(t, err)
+		assert.Equal(t, "older", v)
+	}()
+	pending = <-backend.calls
+	assert.False(t, cr.Invalidate("other"))
+	pending <- "older"
+
+	go func() {
+		(<-backend.calls) <- "newest"
+	}()
+	v, err = cr.Resolve(context.Background(), "other")
+	require.NoError(t, err)
+	assert.Equal(t, "newest", v)
+}
@@ -0,0 +1,169 @@
+package index
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Mirror is a retrieval endpoint which holds a copy of the snapshots.
+type Mirror struct {
+	// Prefix is the URL prefix objects can be retrieved from, eg: https://mirror.example.com/
+	Prefix string
+	// Weight is the share of requests sent to the mirror relative to the others, defaults to 1
+	Weight int
+	// Region is an optional label matched against the region clients ask for
+	Region string
+}
+
+// URL returns the location of key on the mirror.
+func (m Mirror) URL(key string) (string, error) {
+	return url.JoinPath(m.Prefix, key)
+}
+
+// MirrorHealth is the result of the last check of a mirror.
+type MirrorHealth struct {
+	Mirror
+	Healthy bool
+	Checked time.Time
+	Error   string
+}
+
+// MirrorSet selects a healthy mirror to send clients to. Mirrors are healthy until a check fails.
+type MirrorSet struct {
+	client *http.Client
+
+	mu     sync.RWMutex
+	health []MirrorHealth
+}
+
+func NewMirrorSet(mirrors []Mirror, client *http.Client) *MirrorSet {
+	health := make([]MirrorHealth, len(mirrors))
+	for i, m := range mirrors {
+		if m.Weight <= 0 {
+			m.Weight = 1
+		}
+		health[i] = MirrorHealth{Mirror: m, Healthy: true}
+	}
+
+	return &MirrorSet{
+		client: client,
+		health: health,
+	}
+}
+
+// Health returns the result of the last check of each mirror.
+func (m *MirrorSet) Health() []MirrorHealth {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	health := make([]MirrorHealth, len(m.health))
+	copy(health, m.health)
+
+	return health
+}
+
+// Check requests the object at key from every mirror, marking those which fail to serve it as unhealthy.
+func (m *MirrorSet) Check(ctx context.Context, key string) {
+	var wg sync.WaitGroup
+	results := make([]MirrorHealth, len(m.health))
+
+	for i, h := range m.Health() {
+		wg.Add(1)
+		go func(i int, mirror Mirror) {
+			defer wg.Done()
+
+			result := MirrorHealth{Mirror: mirror, Healthy: true, Checked: time.Now()}
+			if err := m.check(ctx, mirror, key); err != nil {
+				result.Healthy = false
+				result.Error = err.Error()
+			}
+			results[i] = result
+		}(i, h.Mirror)
+	}
+
+	wg.Wait()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, result := range results {
+		if result.Healthy != m.health[i].Healthy {
+			logger.Warnw("mirror health changed", "mirror", result.Prefix, "healthy", result.Healthy, "err", result.Error)
+		}
+		m.health[i] = result
+	}
+}
+
+func (m *MirrorSet) check(ctx context.Context, mirror Mirror, key string) error {
+	u, err := mirror.URL(key)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, u, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// Select picks a healthy mirror by weight, preferring those in region when any are healthy.
+func (m *MirrorSet) Select(region string) (Mirror, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var healthy, local []Mirror
+	for _, h := range m.health {
+		if !h.Healthy {
+			continue
+		}
+
+		healthy = append(healthy, h.Mirror)
+		if region != "" && h.Region == region {
+			local = append(local, h.Mirror)
+		}
+	}
+
+	if len(local) > 0 {
+		return pickWeighted(local), true
+	}
+
+	if len(healthy) > 0 {
+		return pickWeighted(healthy), true
+	}
+
+	return Mirror{}, false
+}
+
+func pickWeighted(mirrors []Mirror) Mirror {
+	total := 0
+	for _, m := range mirrors {
+		total += m.Weight
+	}
+
+	n := rand.Intn(total)
+	for _, m := range mirrors {
+		if n < m.Weight {
+			return m
+		}
+		n -= m.Weight
+	}
+
+	return mirrors[len(mirrors)-1]
+}
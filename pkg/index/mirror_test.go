@@ -0,0 +1,65 @@
+package index
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMirrorSet(t *testing.T) {
+	serving := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/minimal/1200_2020_08_25T22_00_00Z.car.zst" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer serving.Close()
+
+	missing := httptest.NewServer(http.NotFoundHandler())
+	defer missing.Close()
+
+	ms := NewMirrorSet([]Mirror{
+		{Prefix: serving.URL + "/", Weight: 1, Region: "us"},
+		{Prefix: missing.URL + "/", Weight: 1, Region: "eu"},
+	}, serving.Client())
+
+	// mirrors are healthy until checked, the region is preferred
+	m, ok := ms.Select("eu")
+	require.True(t, ok)
+	assert.Equal(t, missing.URL+"/", m.Prefix)
+
+	ms.Check(context.Background(), "minimal/1200_2020_08_25T22_00_00Z.car.zst")
+
+	health := ms.Health()
+	assert.True(t, health[0].Healthy)
+	assert.False(t, health[1].Healthy)
+	assert.NotEmpty(t, health[1].Error)
+
+	// clients in the region of an unhealthy mirror fail over to the healthy one
+	for i := 0; i < 10; i++ {
+		m, ok = ms.Select("eu")
+		require.True(t, ok)
+		assert.Equal(t, serving.URL+"/", m.Prefix)
+	}
+
+	ms.Check(context.Background(), "minimal/missing.car.zst")
+	_, ok = ms.Select("")
+	assert.False(t, ok)
+}
+
+func TestPickWeighted(t *testing.T) {
+	mirrors := []Mirror{{Prefix: "a", Weight: 3}, {Prefix: "b", Weight: 1}}
+
+	counts := map[string]int{}
+	for i := 0; i < 4000; i++ {
+		counts[pickWeighted(mirrors).Prefix]++
+	}
+
+	assert.InDelta(t, 3000, counts["a"], 300)
+	assert.InDelta(t, 1000, counts["b"], 300)
+}
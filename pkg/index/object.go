@@ -0,0 +1,99 @@
+package index
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"golang.org/x/xerrors"
+)
+
+var ErrObjectNotFound = errors.New("object not found")
+
+// Object is an open object which can be read from any offset.
+type Object struct {
+	io.ReadSeekCloser
+
+	Key         string
+	Size        int64
+	ETag        string
+	ContentType string
+	ModTime     time.Time
+}
+
+// ObjectStore opens objects so they can be streamed to clients.
+type ObjectStore interface {
+	Open(context.Context, string) (*Object, error)
+}
+
+type IndexS3ObjectStore struct {
+	client s3ClientInterface
+	bucket string
+}
+
+func NewIndexS3ObjectStore(client s3ClientInterface, bucket string) *IndexS3ObjectStore {
+	return &IndexS3ObjectStore{
+		client: client,
+		bucket: bucket,
+	}
+}
+
+// Open returns the object stored at key. Data is only requested as it is read, seeking starts a new ranged request.
+func (i *IndexS3ObjectStore) Open(ctx context.Context, key string) (*Object, error) {
+	object, err := i.client.GetObject(ctx, i.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, xerrors.Errorf("failed to open object: %w", err)
+	}
+
+	info, err := object.Stat()
+	if err != nil {
+		object.Close()
+		if minio.ToErrorResponse(err).StatusCode == http.StatusNotFound {
+			return nil, ErrObjectNotFound
+		}
+		return nil, xerrors.Errorf("failed to stat object: %w", err)
+	}
+
+	return &Object{
+		ReadSeekCloser: object,
+		Key:            key,
+		Size:           info.Size,
+		ETag:           info.ETag,
+		ContentType:    info.ContentType,
+		ModTime:        info.LastModified,
+	}, nil
+}
+
+// Presigner creates time limited URLs which allow anyone holding them to download an object.
+type Presigner interface {
+	Presign(context.Context, string, time.Duration) (string, error)
+}
+
+type s3PresignClientInterface interface {
+	PresignedGetObject(ctx context.Context, bucketName, objectName string, expires time.Duration, reqParams url.Values) (*url.URL, error)
+}
+
+type IndexS3Presigner struct {
+	client s3PresignClientInterface
+	bucket string
+}
+
+func NewIndexS3Presigner(client s3PresignClientInterface, bucket string) *IndexS3Presigner {
+	return &IndexS3Presigner{
+		client: client,
+		bucket: bucket,
+	}
+}
+
+func (i *IndexS3Presigner) Presign(ctx context.Context, key string, expiry time.Duration) (string, error) {
+	u, err := i.client.PresignedGetObject(ctx, i.bucket, key, expiry, url.Values{})
+	if err != nil {
+		return "", xerrors.Errorf("failed to presign object: %w", err)
+	}
+
+	return u.String(), nil
+}
@@ -0,0 +1,60 @@
+package operator
+
+import (
+	"context"
+
+	"github.com/ipfs/go-log/v2"
+
+	"github.com/filecoin-project/filecoin-chain-archiver/build"
+	"github.com/filecoin-project/filecoin-chain-archiver/pkg/index/api"
+)
+
+var logger = log.Logger("filecoin-chain-archiver/operator/index-resolver")
+
+// Cache is implemented by the index service to inspect and control the caches of its routes.
+type Cache interface {
+	CacheList(context.Context) ([]api.RouteCache, error)
+	CacheFlush(context.Context) error
+	CacheInvalidate(context.Context, string) error
+	CacheRefresh(context.Context, string) (string, error)
+	Resolved(context.Context) ([]api.Resolved, error)
+}
+
+type OperatorImpl struct {
+	Cache Cache
+}
+
+func (s *OperatorImpl) Version(ctx context.Context) (string, error) {
+	return build.Version(), nil
+}
+
+func (s *OperatorImpl) LogList(ctx context.Context) ([]string, error) {
+	return log.GetSubsystems(), nil
+}
+
+func (s *OperatorImpl) LogSetLevel(ctx context.Context, subsystem string, level string) error {
+	return log.SetLogLevel(subsystem, level)
+}
+
+func (s *OperatorImpl) CacheList(ctx context.Context) ([]api.RouteCache, error) {
+	return s.Cache.CacheList(ctx)
+}
+
+func (s *OperatorImpl) CacheFlush(ctx context.Context) error {
+	logger.Infow("cache flush")
+	return s.Cache.CacheFlush(ctx)
+}
+
+func (s *OperatorImpl) CacheInvalidate(ctx context.Context, key string) error {
+	logger.Infow("cache invalidate", "key", key)
+	return s.Cache.CacheInvalidate(ctx, key)
+}
+
+func (s *OperatorImpl) CacheRefresh(ctx context.Context, key string) (string, error) {
+	logger.Infow("cache refresh", "key", key)
+	return s.Cache.CacheRefresh(ctx, key)
+}
+
+func (s *OperatorImpl) Resolved(ctx context.Context) ([]api.Resolved, error) {
+	return s.Cache.Resolved(ctx)
+}
@@ -0,0 +1,91 @@
+package service
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// clientTokens maps client tokens to the name of the client holding them.
+type clientTokens map[string]string
+
+// loadClientTokens reads a file of `name:token` lines. Blank lines and lines starting with # are ignored.
+func loadClientTokens(p string) (clientTokens, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file %s: %w", p, err)
+	}
+	defer f.Close()
+
+	tokens := make(clientTokens)
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		name, token, ok := strings.Cut(line, ":")
+		name, token = strings.TrimSpace(name), strings.TrimSpace(token)
+		if !ok || name == "" || token == "" {
+			return nil, fmt.Errorf("%s:%d: expected name:token", p, n)
+		}
+
+		if _, ok := tokens[token]; ok {
+			return nil, fmt.Errorf("%s:%d: duplicate token", p, n)
+		}
+		tokens[token] = name
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read file %s: %w", p, err)
+	}
+
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("%s: no tokens", p)
+	}
+
+	return tokens, nil
+}
+
+// client returns the name of the client holding token.
+func (t clientTokens) client(token string) (string, bool) {
+	// every token is compared so the time taken does not depend on which token matched
+	var name string
+	for candidate, n := range t {
+		if subtle.ConstantTimeCompare([]byte(candidate), []byte(token)) == 1 {
+			name = n
+		}
+	}
+
+	return name, name != ""
+}
+
+func requestToken(r *http.Request) string {
+	if v := r.Header.Get("Authorization"); v != "" {
+		return strings.TrimPrefix(v, "Bearer ")
+	}
+
+	return r.URL.Query().Get("token")
+}
+
+// authorize requires requests to carry one of the client tokens of the route, when it has any.
+func (rt *route) authorize(next http.HandlerFunc) http.HandlerFunc {
+	if rt.tokens == nil {
+		return next
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		name, ok := rt.tokens.client(requestToken(r))
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="filecoin-chain-archiver"`)
+			http.Error(w, "a valid token is required", http.StatusUnauthorized)
+			return
+		}
+
+		logger.Infow("authorized", "client", name, "uri", r.URL.Path)
+		next(w, r)
+	}
+}
@@ -0,0 +1,150 @@
+package service
+
+import (
+	"fmt"
+
+	"github.com/filecoin-project/filecoin-chain-archiver/pkg/config"
+	"github.com/filecoin-project/filecoin-chain-archiver/pkg/index"
+)
+
+// backend creates the resolver, lister and object store of a route from a configured resolver. The bucket of a
+// route overrides the bucket of s3 backends when it is set.
+type backend struct {
+	resolver func(bucket string) index.Resolver
+	lister   func(bucket string) index.Lister
+	objects  func(bucket string) index.ObjectStore
+	// presigner is nil when the backend can not presign URLs
+	presigner func(bucket string) index.Presigner
+}
+
+// setupResolvers creates the configured resolver backends by name. The top level S3Resolver is named default.
+func (bs *IndexService) setupResolvers(cfg *config.IndexServiceConfig) (map[string]*backend, error) {
+	resolvers := make(map[string]*backend)
+
+	rcfgs := append([]config.ResolverConfig{{
+		Name: config.DefaultResolverName,
+		Type: config.ResolverTypeS3,
+		S3:   cfg.S3Resolver,
+	}}, cfg.Resolvers...)
+
+	for _, rcfg := range rcfgs {
+		if _, ok := resolvers[rcfg.Name]; ok {
+			return nil, fmt.Errorf("duplicate resolver %q", rcfg.Name)
+		}
+
+		// the default resolver is only required when a route uses it
+		if rcfg.Name == config.DefaultResolverName && rcfg.S3.Endpoint == "" {
+			continue
+		}
+
+		var (
+			b   *backend
+			err error
+		)
+		switch rcfg.Type {
+		case "", config.ResolverTypeS3:
+			b, err = newS3Backend(rcfg.S3)
+		case config.ResolverTypeFilesystem:
+			b, err = newFilesystemBackend(rcfg.Filesystem)
+		case config.ResolverTypeChain:
+			b, err = newChainBackend(rcfg.Chain, resolvers)
+		default:
+			err = fmt.Errorf("unknown type %q", rcfg.Type)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("resolver %q: %w", rcfg.Name, err)
+		}
+
+		resolvers[rcfg.Name] = b
+	}
+
+	return resolvers, nil
+}
+
+func newS3Backend(cfg config.S3ResolverConfig) (*backend, error) {
+	client, err := newS3Client(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	orDefault := func(bucket string) string {
+		if bucket == "" {
+			return cfg.Bucket
+		}
+		return bucket
+	}
+
+	return &backend{
+		resolver: func(bucket string) index.Resolver {
+			return index.NewIndexS3Resolver(client, orDefault(bucket))
+		},
+		lister: func(bucket string) index.Lister {
+			return index.NewIndexS3Lister(client, orDefault(bucket), cfg.RetrievalEndpointPrefix)
+		},
+		objects: func(bucket string) index.ObjectStore {
+			return index.NewIndexS3ObjectStore(client, orDefault(bucket))
+		},
+		presigner: func(bucket string) index.Presigner {
+			return index.NewIndexS3Presigner(client, orDefault(bucket))
+		},
+	}, nil
+}
+
+func newFilesystemBackend(cfg config.FilesystemResolverConfig) (*backend, error) {
+	if cfg.Path == "" {
+		return nil, fmt.Errorf("path is required")
+	}
+
+	return &backend{
+		resolver: func(string) index.Resolver {
+			return index.NewIndexFSResolver(cfg.Path)
+		},
+		lister: func(string) index.Lister {
+			return index.NewIndexFSLister(cfg.Path, cfg.RetrievalEndpointPrefix)
+		},
+		objects: func(string) index.ObjectStore {
+			return index.NewIndexFSObjectStore(cfg.Path)
+		},
+	}, nil
+}
+
+// newChainBackend tries each of the named backends in order. Only backends configured before the chain can be used,
+// which keeps chains from referring to themselves.
+func newChainBackend(names []string, resolvers map[string]*backend) (*backend, error) {
+	if len(names) == 0 {
+		return nil, fmt.Errorf("chain is empty")
+	}
+
+	var chain []*backend
+	for _, name := range names {
+		b, ok := resolvers[name]
+		if !ok {
+			return nil, fmt.Errorf("chained resolver %q must be configured before the chain", name)
+		}
+		chain = append(chain, b)
+	}
+
+	return &backend{
+		resolver: func(bucket string) index.Resolver {
+			var rs []index.Resolver
+			for _, b := range chain {
+				rs = append(rs, b.resolver(bucket))
+			}
+			return index.NewChainResolver(rs...)
+		},
+		lister: func(bucket string) index.Lister {
+			var ls []index.Lister
+			for _, b := range chain {
+				ls = append(ls, b.lister(bucket))
+			}
+			return index.NewChainLister(ls...)
+		},
+		objects: func(bucket string) index.ObjectStore {
+			var stores []index.ObjectStore
+			for _, b := range chain {
+				stores = append(stores, b.objects(bucket))
+			}
+			return index.NewChainObjectStore(stores...)
+		},
+	}, nil
+}
@@ -0,0 +1,191 @@
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/filecoin-project/filecoin-chain-archiver/pkg/config"
+	"github.com/filecoin-project/filecoin-chain-archiver/pkg/index"
+)
+
+var browseTemplate = template.Must(template.New("browse").Funcs(template.FuncMap{
+	"size":      formatSize,
+	"withToken": withToken,
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Snapshots {{.Base}}/</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; }
+th, td { padding: 0.3em 0.8em; text-align: left; border-bottom: 1px solid #ddd; }
+td.num { text-align: right; }
+code { font-size: 0.85em; }
+</style>
+</head>
+<body>
+<h1>Snapshots {{.Base}}/</h1>
+<p>The latest snapshot is always available at <a href="{{withToken .Latest $.Token}}">{{.Latest}}</a>. A json listing is available at <a href="{{withToken (printf "%s/snapshots" .Base) $.Token}}">{{.Base}}/snapshots</a>.</p>
+{{- if .Snapshots}}
+<table>
+<thead><tr><th>Height</th><th>Date (UTC)</th><th>Size</th><th>SHA-256</th><th>Download</th></tr></thead>
+<tbody>
+{{- range .Snapshots}}
+<tr><td class="num">{{.Height}}</td><td>{{.Timestamp.UTC.Format "2006-01-02 15:04:05"}}</td><td class="num">{{size .Size}}</td><td><code>{{.Digest}}</code></td><td><a href="{{withToken .Link $.Token}}">{{.Name}}.car.zst</a></td></tr>
+{{- end}}
+</tbody>
+</table>
+{{- else}}
+<p>No snapshots are available yet.</p>
+{{- end}}
+<p>Updated {{.Updated.UTC.Format "2006-01-02 15:04:05"}} UTC</p>
+</body>
+</html>
+`))
+
+type browseSnapshot struct {
+	index.Snapshot
+	Link string
+}
+
+type browsePage struct {
+	Base      string
+	Latest    string
+	Snapshots []browseSnapshot
+	Updated   time.Time
+}
+
+// browseView is a page as rendered for a request, with the token of the client when the route requires one.
+type browseView struct {
+	*browsePage
+	Token string
+}
+
+// withToken adds token to links served by the service, so they are authorized as the page was. Other links, such as
+// retrieval urls, are left as they are.
+func withToken(link, token string) string {
+	if token == "" || !strings.HasPrefix(link, "/") {
+		return link
+	}
+
+	return link + "?token=" + url.QueryEscape(token)
+}
+
+func formatSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// pageCache holds the contents of a page until it expires or is flushed. Pages are rendered for each request as
+// their links depend on the token of the client.
+type pageCache struct {
+	ttl time.Duration
+
+	mu     sync.Mutex
+	page   *browsePage
+	expiry time.Time
+}
+
+func (c *pageCache) get(build func() (*browsePage, error)) (*browsePage, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.page != nil && time.Now().Before(c.expiry) {
+		return c.page, nil
+	}
+
+	page, err := build()
+	if err != nil {
+		return nil, err
+	}
+
+	c.page = page
+	c.expiry = time.Now().Add(c.ttl)
+
+	return page, nil
+}
+
+// flush drops the page, so it is built again from the listing on the next request.
+func (c *pageCache) flush() {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.page = nil
+}
+
+// browseHandler renders the snapshots under the prefix of the route as a html page, newest first.
+func (bs *IndexService) browseHandler(rt *route, cache *pageCache) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		page, err := cache.get(func() (*browsePage, error) {
+			snapshots, err := rt.lister.List(r.Context(), rt.prefix)
+			if err != nil {
+				return nil, err
+			}
+
+			p := &browsePage{
+				Base:    rt.base,
+				Latest:  rt.cfg.Path,
+				Updated: time.Now(),
+			}
+
+			for _, s := range snapshots {
+				link := s.URL
+				// snapshots are served through the lookup route when they are not redirected to directly
+				if rt.cfg.Mode != config.RouteModeRedirect || link == "" {
+					link = fmt.Sprintf("%s/height/%d", rt.base, s.Height)
+				}
+				p.Snapshots = append(p.Snapshots, browseSnapshot{Snapshot: s, Link: link})
+			}
+
+			return p, nil
+		})
+		if err != nil {
+			logger.Errorw("error listing snapshots for browse page", "prefix", rt.prefix, "err", err)
+			http.Error(w, "failed to list snapshots", http.StatusBadGateway)
+			return
+		}
+
+		view := browseView{browsePage: page}
+		if rt.tokens != nil {
+			// the page holds the token of the client, it must not be stored by shared caches
+			view.Token = requestToken(r)
+			w.Header().Set("Cache-Control", "no-store")
+		}
+
+		var buf bytes.Buffer
+		if err := browseTemplate.Execute(&buf, view); err != nil {
+			logger.Errorw("error rendering browse page", "prefix", rt.prefix, "err", err)
+			http.Error(w, "failed to render the page", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if r.Method == http.MethodHead {
+			return
+		}
+
+		if _, err := w.Write(buf.Bytes()); err != nil {
+			logger.Debugw("error writing browse page", "err", err)
+		}
+	}
+}
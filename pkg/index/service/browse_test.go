@@ -0,0 +1,167 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/filecoin-chain-archiver/pkg/config"
+	"github.com/filecoin-project/filecoin-chain-archiver/pkg/index"
+)
+
+type countingLister struct {
+	calls     int32
+	mu        sync.Mutex
+	snapshots []index.Snapshot
+}
+
+func (l *countingLister) set(snapshots []index.Snapshot) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.snapshots = snapshots
+}
+
+func (l *countingLister) List(context.Context, string) ([]index.Snapshot, error) {
+	atomic.AddInt32(&l.calls, 1)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.snapshots, nil
+}
+
+func TestBrowse(t *testing.T) {
+	lister := &countingLister{snapshots: []index.Snapshot{
+		{Name: "1200_2020_08_25T22_00_00Z", Height: 1200, Timestamp: time.Date(2020, 8, 25, 22, 0, 0, 0, time.UTC), Size: 3 << 30, Digest: "abcd", URL: "https://example.com/minimal/1200_2020_08_25T22_00_00Z.car.zst"},
+		{Name: "1100_<script>", Height: 1100, Size: 512},
+	}}
+
+	bs := NewIndexService(context.Background())
+	rt := &route{
+		cfg:    config.RouteConfig{Path: "/minimal/latest", Mode: config.RouteModeRedirect},
+		base:   "/minimal",
+		lister: index.NewCachedLister(lister, index.CacheOptions{}),
+	}
+	handler := bs.browseHandler(rt, &pageCache{ttl: time.Minute})
+
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodGet, "/minimal/", nil))
+
+	body := w.Body.String()
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/html; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Contains(t, body, `<a href="https://example.com/minimal/1200_2020_08_25T22_00_00Z.car.zst">`)
+	assert.Contains(t, body, "2020-08-25 22:00:00")
+	assert.Contains(t, body, "3.0 GiB")
+	assert.Contains(t, body, "<code>abcd</code>")
+	// snapshots without a retrieval url are linked through the lookup route
+	assert.Contains(t, body, `<a href="/minimal/height/1100">`)
+	assert.NotContains(t, body, "<script>")
+	assert.Less(t, strings.Index(body, "1200_"), strings.Index(body, "1100_"))
+
+	// the page is cached
+	handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/minimal/", nil))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&lister.calls))
+}
+
+func TestBrowseOperator(t *testing.T) {
+	lister := &countingLister{}
+
+	bs := NewIndexService(context.Background())
+	rt := &route{
+		cfg:      config.RouteConfig{Path: "/minimal/latest", Key: "minimal/latest", Mode: config.RouteModeRedirect},
+		base:     "/minimal",
+		prefix:   "minimal/",
+		resolver: index.NewCachedResolver(staticResolver("https://example.com/minimal/1200_2020_08_25T22_00_00Z.car.zst"), index.DefaultCacheOptions()),
+		lister:   index.NewCachedLister(lister, index.CacheOptions{TTL: time.Minute}),
+		browse:   &pageCache{ttl: time.Minute},
+	}
+	rt.snapshots = index.NewSnapshotIndex(rt.lister, rt.prefix, time.Minute)
+	rt.listing = rt
+
+	// a later route under the same base is listed by the first
+	other := &route{
+		cfg:      config.RouteConfig{Path: "/minimal/previous", Key: "minimal/previous", Mode: config.RouteModeRedirect},
+		base:     "/minimal",
+		prefix:   "minimal/",
+		resolver: index.NewCachedResolver(staticResolver("https://example.com/minimal/1100_2020_08_24T22_00_00Z.car.zst"), index.DefaultCacheOptions()),
+		lister:   index.NewCachedLister(&countingLister{}, index.CacheOptions{TTL: time.Minute}),
+		listing:  rt,
+		browse:   rt.browse,
+	}
+	bs.state.routes = []*route{rt, other}
+	handler := bs.browseHandler(rt, rt.browse)
+
+	browse := func() string {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest(http.MethodGet, "/minimal/", nil))
+		return w.Body.String()
+	}
+
+	assert.Contains(t, browse(), "No snapshots are available yet.")
+
+	// the operator methods drop the page along with the listing
+	lister.set([]index.Snapshot{{Name: "1200_2020_08_25T22_00_00Z", Height: 1200}})
+	assert.Contains(t, browse(), "No snapshots are available yet.")
+
+	_, err := bs.CacheRefresh(context.Background(), "minimal/latest")
+	require.NoError(t, err)
+	assert.Contains(t, browse(), `<a href="/minimal/height/1200">`)
+
+	lister.set([]index.Snapshot{{Name: "1300_2020_08_26T22_00_00Z", Height: 1300}})
+	require.NoError(t, bs.CacheInvalidate(context.Background(), "minimal/latest"))
+	assert.Contains(t, browse(), `<a href="/minimal/height/1300">`)
+
+	// keys of later routes drop the listing of the base as well
+	lister.set([]index.Snapshot{{Name: "1400_2020_08_27T22_00_00Z", Height: 1400}})
+	_, err = bs.CacheRefresh(context.Background(), "minimal/previous")
+	require.NoError(t, err)
+	assert.Contains(t, browse(), `<a href="/minimal/height/1400">`)
+
+	lister.set([]index.Snapshot{{Name: "1500_2020_08_28T22_00_00Z", Height: 1500}})
+	require.NoError(t, bs.CacheInvalidate(context.Background(), "minimal/previous"))
+	assert.Contains(t, browse(), `<a href="/minimal/height/1500">`)
+
+	lister.set(nil)
+	require.NoError(t, bs.CacheFlush(context.Background()))
+	assert.Contains(t, browse(), "No snapshots are available yet.")
+}
+
+func TestBrowseToken(t *testing.T) {
+	lister := &countingLister{snapshots: []index.Snapshot{
+		{Name: "1200_2020_08_25T22_00_00Z", Height: 1200, URL: "https://example.com/minimal/1200_2020_08_25T22_00_00Z.car.zst"},
+	}}
+
+	bs := NewIndexService(context.Background())
+	rt := &route{
+		cfg:    config.RouteConfig{Path: "/minimal/latest", Mode: config.RouteModeProxy},
+		base:   "/minimal",
+		lister: index.NewCachedLister(lister, index.CacheOptions{}),
+		tokens: clientTokens{"s&cret": "alice"},
+	}
+	handler := rt.authorize(bs.browseHandler(rt, &pageCache{ttl: time.Minute}))
+
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodGet, "/minimal/?token=s%26cret", nil))
+
+	// links to the service carry the token the page was requested with
+	body := w.Body.String()
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+	assert.Contains(t, body, `<a href="/minimal/latest?token=s%26cret">`)
+	assert.Contains(t, body, `<a href="/minimal/snapshots?token=s%26cret">`)
+	assert.Contains(t, body, `<a href="/minimal/height/1200?token=s%26cret">`)
+
+	r := httptest.NewRequest(http.MethodGet, "/minimal/", nil)
+	r.Header.Set("Authorization", "Bearer s&cret")
+	w = httptest.NewRecorder()
+	handler(w, r)
+	assert.Contains(t, w.Body.String(), `<a href="/minimal/height/1200?token=s%26cret">`)
+}
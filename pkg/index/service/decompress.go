@@ -0,0 +1,112 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/filecoin-project/filecoin-chain-archiver/pkg/index"
+)
+
+// CarSuffix is the suffix of decompressed snapshots
+const CarSuffix = ".car"
+
+// decompressRetryAfter is sent to clients refused because too many downloads are being decompressed
+const decompressRetryAfter = 60
+
+// decompressHandler streams the latest snapshot through a zstd decoder, so clients which can not decompress it are
+// served from the same stored object. The size is not known up front, so range requests are not supported. At most
+// cap(sem) downloads are decompressed at once, each decoding windows of up to maxWindow bytes.
+func (bs *IndexService) decompressHandler(rt *route, sem chan struct{}, maxWindow uint64) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		value, err := rt.resolver.Resolve(r.Context(), rt.cfg.Key)
+		if err != nil {
+			logger.Errorw("error resolving", "key", rt.cfg.Key, "err", err)
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+
+		u, err := url.Parse(value)
+		if err != nil || !strings.HasSuffix(u.Path, index.SnapshotSuffix) {
+			logger.Errorw("resolved location is not a snapshot", "key", rt.cfg.Key, "location", value)
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+
+		filename := path.Base(u.Path)
+		name := strings.TrimSuffix(filename, index.SnapshotSuffix) + CarSuffix
+
+		w.Header().Set("Content-Type", "application/vnd.ipld.car")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s", strconv.Quote(name)))
+
+		if r.Method == http.MethodHead {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		select {
+		case sem <- struct{}{}:
+			defer func() { <-sem }()
+		default:
+			decompressRequests.WithLabelValues(rt.cfg.Path, "rejected").Inc()
+			w.Header().Set("Retry-After", strconv.Itoa(decompressRetryAfter))
+			http.Error(w, "too many decompressed downloads, try again later", http.StatusServiceUnavailable)
+			return
+		}
+
+		releaseConcurrency(r)
+
+		decompressActive.Inc()
+		defer decompressActive.Dec()
+
+		object, err := rt.objects.Open(r.Context(), rt.prefix+filename)
+		if err != nil {
+			decompressRequests.WithLabelValues(rt.cfg.Path, "failed").Inc()
+			if errors.Is(err, index.ErrObjectNotFound) {
+				http.Error(w, "snapshot not found", http.StatusNotFound)
+				return
+			}
+
+			logger.Errorw("error opening object", "key", rt.prefix+filename, "err", err)
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		defer object.Close()
+
+		// decoding is kept to a single goroutine per download, the concurrency limit bounds the total
+		dec, err := zstd.NewReader(object, zstd.WithDecoderConcurrency(1), zstd.WithDecoderLowmem(true), zstd.WithDecoderMaxWindow(maxWindow))
+		if err != nil {
+			decompressRequests.WithLabelValues(rt.cfg.Path, "failed").Inc()
+			logger.Errorw("error creating decoder", "err", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		defer dec.Close()
+
+		n, err := io.Copy(w, dec)
+		decompressBytes.WithLabelValues(rt.cfg.Path).Add(float64(n))
+		if errors.Is(err, zstd.ErrWindowSizeExceeded) {
+			decompressRequests.WithLabelValues(rt.cfg.Path, "failed").Inc()
+			logger.Errorw("snapshot window is larger than Decompress.MaxWindow", "key", object.Key, "max_window", maxWindow, "bytes", n)
+			if n == 0 {
+				http.Error(w, "snapshot was compressed with a window too large to decompress", http.StatusBadGateway)
+			}
+			return
+		}
+		if err != nil {
+			// the status has already been sent, the client sees a truncated response
+			decompressRequests.WithLabelValues(rt.cfg.Path, "failed").Inc()
+			logger.Warnw("decompressed download failed", "key", object.Key, "bytes", n, "err", err)
+			return
+		}
+
+		decompressRequests.WithLabelValues(rt.cfg.Path, "completed").Inc()
+	}
+}
@@ -0,0 +1,195 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/filecoin-project/filecoin-chain-archiver/pkg/index"
+)
+
+const (
+	// maxManifestSize bounds how much of a manifest is read
+	maxManifestSize = 1 << 20
+	// freshnessTimeout bounds each check of the latest snapshot
+	freshnessTimeout = 30 * time.Second
+)
+
+// freshness is the result of the last check of the latest snapshot of a route.
+type freshness struct {
+	snapshot index.Snapshot
+	checked  time.Time
+	err      error
+}
+
+type routeFreshness struct {
+	Path          string    `json:"path"`
+	Key           string    `json:"key"`
+	Name          string    `json:"name,omitempty"`
+	Height        int64     `json:"height,omitempty"`
+	Timestamp     time.Time `json:"timestamp"`
+	AgeSeconds    int64     `json:"age_seconds"`
+	MaxAgeSeconds int64     `json:"max_age_seconds,omitempty"`
+	Checked       time.Time `json:"checked"`
+	Fresh         bool      `json:"fresh"`
+	Error         string    `json:"error,omitempty"`
+}
+
+type freshnessReport struct {
+	Fresh  bool             `json:"fresh"`
+	Routes []routeFreshness `json:"routes"`
+}
+
+// latestSnapshot describes the snapshot the route currently resolves to. The height and time are parsed from its
+// name, or read from its manifest when the name does not contain them.
+func (rt *route) latestSnapshot(ctx context.Context) (index.Snapshot, error) {
+	location, err := rt.resolver.Resolve(ctx, rt.cfg.Key)
+	if err != nil {
+		return index.Snapshot{}, err
+	}
+
+	u, err := url.Parse(location)
+	if err != nil {
+		return index.Snapshot{}, err
+	}
+
+	filename := path.Base(u.Path)
+	name := strings.TrimSuffix(filename, index.SnapshotSuffix)
+
+	if height, t, ok := index.ParseSnapshotName(filename); ok {
+		return index.Snapshot{
+			Name:      name,
+			Key:       rt.prefix + filename,
+			Height:    height,
+			Timestamp: t,
+			URL:       location,
+		}, nil
+	}
+
+	key := rt.prefix + name + index.ManifestSuffix
+	object, err := rt.objects.Open(ctx, key)
+	if err != nil {
+		return index.Snapshot{}, fmt.Errorf("snapshot name %q has no height and time, failed to read manifest: %w", filename, err)
+	}
+	defer object.Close()
+
+	var snapshot index.Snapshot
+	if err := json.NewDecoder(io.LimitReader(object, maxManifestSize)).Decode(&snapshot); err != nil {
+		return index.Snapshot{}, fmt.Errorf("failed to decode manifest %s: %w", key, err)
+	}
+
+	if snapshot.Timestamp.IsZero() {
+		return index.Snapshot{}, fmt.Errorf("manifest %s has no timestamp", key)
+	}
+
+	return snapshot, nil
+}
+
+// checkFreshness checks the latest snapshot of the route every interval until ctx is done.
+func (bs *IndexService) checkFreshness(ctx context.Context, rt *route, interval time.Duration) {
+	check := func() {
+		ctx, cancel := context.WithTimeout(ctx, freshnessTimeout)
+		defer cancel()
+
+		snapshot, err := rt.latestSnapshot(ctx)
+		if err != nil {
+			logger.Warnw("error checking freshness", "route", rt.cfg.Path, "err", err)
+		} else {
+			snapshotAge.WithLabelValues(rt.cfg.Path).Set(time.Since(snapshot.Timestamp).Seconds())
+			snapshotHeight.WithLabelValues(rt.cfg.Path).Set(float64(snapshot.Height))
+		}
+
+		rt.freshMu.Lock()
+		defer rt.freshMu.Unlock()
+		rt.fresh = freshness{
+			snapshot: snapshot,
+			checked:  time.Now(),
+			err:      err,
+		}
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		check()
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (rt *route) freshness(now time.Time, maxAge time.Duration) routeFreshness {
+	rt.freshMu.Lock()
+	f := rt.fresh
+	rt.freshMu.Unlock()
+
+	report := routeFreshness{
+		Path:          rt.cfg.Path,
+		Key:           rt.cfg.Key,
+		MaxAgeSeconds: int64(maxAge.Seconds()),
+		Checked:       f.checked,
+	}
+
+	switch {
+	case maxAge == 0:
+		// the check is disabled, routes are not checked
+		report.Fresh = true
+		return report
+	case f.checked.IsZero():
+		report.Error = "not checked yet"
+		return report
+	case f.err != nil:
+		report.Error = f.err.Error()
+		return report
+	}
+
+	age := now.Sub(f.snapshot.Timestamp)
+
+	report.Name = f.snapshot.Name
+	report.Height = f.snapshot.Height
+	report.Timestamp = f.snapshot.Timestamp
+	report.AgeSeconds = int64(age.Seconds())
+	report.Fresh = age <= maxAge
+
+	return report
+}
+
+func (bs *IndexService) freshnessReport() freshnessReport {
+	now := time.Now()
+	report := freshnessReport{
+		Fresh:  true,
+		Routes: []routeFreshness{},
+	}
+
+	st := bs.current()
+	for _, rt := range st.routes {
+		f := rt.freshness(now, st.freshness.MaxAge)
+		report.Fresh = report.Fresh && f.Fresh
+		report.Routes = append(report.Routes, f)
+	}
+
+	return report
+}
+
+// freshnessHandler reports the age of the latest snapshot of every route, failing when any is older than the
+// maximum age or could not be checked.
+func (bs *IndexService) freshnessHandler(w http.ResponseWriter, r *http.Request) {
+	report := bs.freshnessReport()
+
+	status := http.StatusOK
+	if !report.Fresh {
+		status = http.StatusServiceUnavailable
+	}
+
+	writeJSON(w, status, report)
+}
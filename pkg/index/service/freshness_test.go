@@ -0,0 +1,110 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/filecoin-chain-archiver/pkg/config"
+	"github.com/filecoin-project/filecoin-chain-archiver/pkg/index"
+)
+
+type staticResolver string
+
+func (s staticResolver) Resolve(context.Context, string) (string, error) {
+	return string(s), nil
+}
+
+func TestFreshness(t *testing.T) {
+	recent := time.Now().Add(-time.Hour).UTC().Truncate(time.Second)
+
+	named := &route{
+		cfg:      config.RouteConfig{Path: "/minimal/latest", Key: "minimal/latest"},
+		prefix:   "minimal/",
+		resolver: index.NewCachedResolver(staticResolver("https://example.com/minimal/1200_2020_08_25T22_00_00Z.car.zst"), index.DefaultCacheOptions()),
+	}
+
+	manifest, err := json.Marshal(index.Snapshot{Name: "snapshot", Height: 3000, Timestamp: recent})
+	require.NoError(t, err)
+
+	// names without a height and time are described by their manifest
+	unnamed := &route{
+		cfg:      config.RouteConfig{Path: "/full/latest", Key: "full/latest"},
+		prefix:   "full/",
+		resolver: index.NewCachedResolver(staticResolver("https://example.com/full/snapshot.car.zst"), index.DefaultCacheOptions()),
+		objects:  memoryObjectStore{"full/snapshot.json": manifest},
+	}
+
+	s, err := named.latestSnapshot(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, int64(1200), s.Height)
+
+	s, err = unnamed.latestSnapshot(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, int64(3000), s.Height)
+	assert.Equal(t, recent, s.Timestamp)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	bs := NewIndexService(ctx)
+	bs.state.routes = []*route{named, unnamed}
+	bs.state.freshness = config.FreshnessConfig{MaxAge: 24 * time.Hour}
+
+	for _, rt := range bs.state.routes {
+		go bs.checkFreshness(ctx, rt, time.Minute)
+	}
+
+	require.Eventually(t, func() bool {
+		for _, f := range bs.freshnessReport().Routes {
+			if f.Checked.IsZero() {
+				return false
+			}
+		}
+		return true
+	}, time.Second, 5*time.Millisecond)
+
+	w := httptest.NewRecorder()
+	bs.freshnessHandler(w, httptest.NewRequest(http.MethodGet, "/health/freshness", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+
+	var report freshnessReport
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&report))
+	assert.False(t, report.Fresh)
+	assert.False(t, report.Routes[0].Fresh)
+	assert.True(t, report.Routes[1].Fresh)
+	assert.InDelta(t, 3600, report.Routes[1].AgeSeconds, 5)
+
+	bs.state.routes = []*route{unnamed}
+	w = httptest.NewRecorder()
+	bs.freshnessHandler(w, httptest.NewRequest(http.MethodGet, "/health/freshness", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestFreshnessDisabled(t *testing.T) {
+	bs := NewIndexService(context.Background())
+	bs.state.routes = []*route{
+		// not checked yet
+		{cfg: config.RouteConfig{Path: "/minimal/latest", Key: "minimal/latest"}},
+		// failed to check
+		{cfg: config.RouteConfig{Path: "/full/latest", Key: "full/latest"}, fresh: freshness{checked: time.Now(), err: errors.New("backend unavailable")}},
+	}
+
+	w := httptest.NewRecorder()
+	bs.freshnessHandler(w, httptest.NewRequest(http.MethodGet, "/health/freshness", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var report freshnessReport
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&report))
+	assert.True(t, report.Fresh)
+	for _, f := range report.Routes {
+		assert.True(t, f.Fresh, f.Path)
+	}
+}
@@ -0,0 +1,108 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/filecoin-project/filecoin-chain-archiver/pkg/config"
+	"github.com/filecoin-project/filecoin-chain-archiver/pkg/index"
+)
+
+// parseLookupTime accepts an RFC3339 time, or a date which selects the last snapshot taken on that day (UTC).
+func parseLookupTime(v string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+
+	d, err := time.Parse("2006-01-02", v)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q, expected RFC3339 or YYYY-MM-DD", v)
+	}
+
+	return d.Add(24*time.Hour - time.Second), nil
+}
+
+// heightHandler serves the snapshot at or just before the requested epoch.
+func (bs *IndexService) heightHandler(rt *route) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		v := mux.Vars(r)["epoch"]
+		height, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid epoch %q", v), http.StatusBadRequest)
+			return
+		}
+
+		snapshot, err := rt.snapshots.AtHeight(height)
+		bs.serveSnapshot(w, r, rt, snapshot, err, fmt.Sprintf("epoch %d", height))
+	}
+}
+
+// timeHandler serves the snapshot at or just before the requested time.
+func (bs *IndexService) timeHandler(rt *route) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		t, err := parseLookupTime(mux.Vars(r)["time"])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		snapshot, err := rt.snapshots.AtTime(t)
+		bs.serveSnapshot(w, r, rt, snapshot, err, t.UTC().Format(time.RFC3339))
+	}
+}
+
+func (bs *IndexService) serveSnapshot(w http.ResponseWriter, r *http.Request, rt *route, snapshot index.Snapshot, err error, target string) {
+	si := rt.snapshots
+	switch {
+	case err == nil:
+	case errors.Is(err, index.ErrNoSnapshots):
+		http.Error(w, "no snapshots are available yet", http.StatusNotFound)
+		return
+	case errors.Is(err, index.ErrBeyondNewest):
+		newest, _ := si.Newest()
+		http.Error(w, fmt.Sprintf("%s is beyond the newest snapshot (height %d, %s), which is available at %s",
+			target, newest.Height, newest.Timestamp.Format(time.RFC3339), rt.cfg.Path), http.StatusNotFound)
+		return
+	case errors.Is(err, index.ErrBeforeOldest):
+		snapshots := si.Snapshots()
+		if len(snapshots) == 0 {
+			http.Error(w, "no snapshots are available yet", http.StatusNotFound)
+			return
+		}
+
+		oldest := snapshots[len(snapshots)-1]
+		http.Error(w, fmt.Sprintf("%s is before the oldest available snapshot (height %d, %s)",
+			target, oldest.Height, oldest.Timestamp.Format(time.RFC3339)), http.StatusNotFound)
+		return
+	default:
+		logger.Errorw("error finding snapshot", "target", target, "err", err)
+		w.WriteHeader(http.StatusBadGateway)
+		return
+	}
+
+	if rt.cfg.Mode != config.RouteModeRedirect {
+		bs.serveObject(w, r, rt, snapshot.Key)
+		return
+	}
+
+	if mirrored, ok := rt.mirrorURL(r, snapshot.Key); ok {
+		w.Header().Add("Vary", mirrorRegionHeader)
+		w.Header().Set("Location", mirrored)
+		w.WriteHeader(http.StatusFound)
+		return
+	}
+
+	if snapshot.URL == "" {
+		logger.Errorw("snapshot has no retrieval url, is RetrievalEndpointPrefix set?", "key", snapshot.Key)
+		w.WriteHeader(http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Location", snapshot.URL)
+	w.WriteHeader(http.StatusFound)
+}
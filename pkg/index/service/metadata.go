@@ -0,0 +1,96 @@
+package service
+
+import (
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/filecoin-project/filecoin-chain-archiver/pkg/config"
+)
+
+// forwardedProtoHeader is the scheme of the request made to a proxy
+const forwardedProtoHeader = "X-Forwarded-Proto"
+
+// wantsJSON reports if the request accepts json. Browsers and curl do not ask for it, so they are redirected.
+func wantsJSON(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil || mediaType != "application/json" {
+			continue
+		}
+
+		if q, err := strconv.ParseFloat(params["q"], 64); err == nil && q == 0 {
+			continue
+		}
+
+		return true
+	}
+
+	return false
+}
+
+// requestURL returns the URL the request was made to, as seen by the client. X-Forwarded-Proto is only honoured
+// from the trusted proxies of the rate limits.
+func (bs *IndexService) requestURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if bs.current().limits.fromTrustedProxy(r) {
+		switch proto := r.Header.Get(forwardedProtoHeader); proto {
+		case "http", "https":
+			scheme = proto
+		}
+	}
+
+	u := url.URL{Scheme: scheme, Host: r.Host, Path: r.URL.Path}
+	return u.String()
+}
+
+// serveMetadata describes the latest snapshot of the route as json. The url is where the snapshot is served from,
+// the same location a redirect would send the client to.
+func (bs *IndexService) serveMetadata(w http.ResponseWriter, r *http.Request, rt *route, location string) {
+	snapshot, err := rt.latestSnapshot(r.Context())
+	if err != nil {
+		logger.Errorw("error describing snapshot", "key", rt.cfg.Key, "err", err)
+		writeError(w, http.StatusBadGateway, "failed to describe the latest snapshot")
+		return
+	}
+
+	// the size and digest are only known from the listing
+	if snapshots, err := rt.lister.List(r.Context(), rt.prefix); err != nil {
+		logger.Warnw("error listing snapshots", "prefix", rt.prefix, "err", err)
+	} else {
+		for _, s := range snapshots {
+			if s.Key == snapshot.Key {
+				snapshot.Size = s.Size
+				snapshot.Digest = s.Digest
+				break
+			}
+		}
+	}
+
+	switch rt.cfg.Mode {
+	case config.RouteModeProxy:
+		// the url is the route itself, so it requires the same token as the request when the route has tokens
+		snapshot.URL = bs.requestURL(r)
+	case config.RouteModePresign:
+		snapshot.URL, err = rt.presigner.Presign(r.Context(), snapshot.Key, rt.cfg.PresignExpiry)
+		if err != nil {
+			logger.Errorw("error presigning object", "key", snapshot.Key, "err", err)
+			writeError(w, http.StatusBadGateway, "failed to presign the latest snapshot")
+			return
+		}
+		w.Header().Set("Cache-Control", "no-store")
+	default:
+		snapshot.URL = location
+		if mirrored, ok := rt.mirrorURL(r, snapshot.Key); ok {
+			w.Header().Add("Vary", mirrorRegionHeader)
+			snapshot.URL = mirrored
+		}
+	}
+
+	writeJSON(w, http.StatusOK, snapshot)
+}
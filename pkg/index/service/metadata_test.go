@@ -0,0 +1,37 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/filecoin-chain-archiver/pkg/config"
+)
+
+func TestRequestURL(t *testing.T) {
+	limits, err := newRateLimits(config.RateLimitConfig{TrustedProxies: []string{"10.0.0.0/8"}})
+	require.NoError(t, err)
+
+	bs := NewIndexService(context.Background())
+	bs.state.limits = limits
+
+	request := func(remote, proto string) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "http://snapshots.example.com/minimal/latest", nil)
+		r.RemoteAddr = remote
+		if proto != "" {
+			r.Header.Set(forwardedProtoHeader, proto)
+		}
+		return r
+	}
+
+	assert.Equal(t, "http://snapshots.example.com/minimal/latest", bs.requestURL(request("198.51.100.7:1234", "")))
+	assert.Equal(t, "https://snapshots.example.com/minimal/latest", bs.requestURL(request("10.1.2.3:1234", "https")))
+
+	// forwarded headers are ignored from clients which are not trusted proxies, and schemes other than http(s)
+	assert.Equal(t, "http://snapshots.example.com/minimal/latest", bs.requestURL(request("198.51.100.7:1234", "https")))
+	assert.Equal(t, "http://snapshots.example.com/minimal/latest", bs.requestURL(request("10.1.2.3:1234", "javascript")))
+}
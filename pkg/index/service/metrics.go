@@ -0,0 +1,124 @@
+package service
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	metrics "github.com/slok/go-http-metrics/metrics/prometheus"
+	"github.com/slok/go-http-metrics/middleware"
+	"github.com/slok/go-http-metrics/middleware/std"
+)
+
+// unmatchedHandler is the handler label of requests which match no route
+const unmatchedHandler = "unmatched"
+
+// httpMetrics records the requests of the service, it is created once as its metrics can only be registered once
+var httpMetrics = middleware.New(middleware.Config{
+	Recorder: metrics.NewRecorder(metrics.Config{}),
+})
+
+var mirrorHealthy = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: "fca",
+	Subsystem: "index",
+	Name:      "mirror_healthy",
+	Help:      "Whether the last health check of a route mirror succeeded",
+}, []string{"route", "mirror"})
+
+var snapshotAge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: "fca",
+	Subsystem: "index",
+	Name:      "snapshot_age_seconds",
+	Help:      "Age of the latest snapshot served by a route",
+}, []string{"route"})
+
+var snapshotHeight = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: "fca",
+	Subsystem: "index",
+	Name:      "snapshot_height",
+	Help:      "Height of the latest snapshot served by a route",
+}, []string{"route"})
+
+var decompressActive = prometheus.NewGauge(prometheus.GaugeOpts{
+	Namespace: "fca",
+	Subsystem: "index",
+	Name:      "decompress_active",
+	Help:      "Number of decompressed downloads being served",
+})
+
+var decompressRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "fca",
+	Subsystem: "index",
+	Name:      "decompress_requests_total",
+	Help:      "Decompressed downloads by result: completed, failed or rejected",
+}, []string{"route", "result"})
+
+var decompressBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "fca",
+	Subsystem: "index",
+	Name:      "decompress_bytes_total",
+	Help:      "Decompressed bytes served",
+}, []string{"route"})
+
+var configReloads = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "fca",
+	Subsystem: "index",
+	Name:      "config_reloads_total",
+	Help:      "Reloads of the configuration by result: succeeded or failed",
+}, []string{"result"})
+
+var rateLimit = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: "fca",
+	Subsystem: "index",
+	Name:      "rate_limit",
+	Help:      "Configured request limits: requests_per_second and burst of each client, and max_concurrent",
+}, []string{"limit"})
+
+var rateLimited = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "fca",
+	Subsystem: "index",
+	Name:      "rate_limited_total",
+	Help:      "Requests refused by reason: client when a client is over its rate, concurrency when too many are served",
+}, []string{"reason"})
+
+var rateLimitClients = prometheus.NewGauge(prometheus.GaugeOpts{
+	Namespace: "fca",
+	Subsystem: "index",
+	Name:      "rate_limit_clients",
+	Help:      "Number of clients whose request rate is tracked",
+})
+
+var requestsInFlight = prometheus.NewGauge(prometheus.GaugeOpts{
+	Namespace: "fca",
+	Subsystem: "index",
+	Name:      "requests_in_flight",
+	Help:      "Number of requests being served",
+})
+
+func init() {
+	prometheus.MustRegister(mirrorHealthy, snapshotAge, snapshotHeight, decompressActive, decompressRequests, decompressBytes, configReloads,
+		rateLimit, rateLimited, rateLimitClients, requestsInFlight)
+}
+
+// metricsMiddleware records requests labelled with the path template of the route of the current state they match,
+// so the number of series is bounded by the configured routes rather than the paths clients request.
+func (bs *IndexService) metricsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		std.Handler(bs.handlerID(r), httpMetrics, next).ServeHTTP(w, r)
+	})
+}
+
+// handlerID returns the path template of the route matching r, or unmatchedHandler.
+func (bs *IndexService) handlerID(r *http.Request) string {
+	var match mux.RouteMatch
+	if !bs.current().router.Match(r, &match) || match.Route == nil {
+		return unmatchedHandler
+	}
+
+	tmpl, err := match.Route.GetPathTemplate()
+	if err != nil {
+		return unmatchedHandler
+	}
+
+	return tmpl
+}
@@ -0,0 +1,81 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetricsHandlerLabel(t *testing.T) {
+	root := t.TempDir()
+	p := filepath.Join(root, "minimal/latest")
+	require.NoError(t, os.MkdirAll(filepath.Dir(p), 0755))
+	require.NoError(t, os.WriteFile(p, []byte("https://example.com/minimal/1200_2020_08_25T22_00_00Z.car.zst"), 0644))
+
+	cfgPath := filepath.Join(t.TempDir(), "config.toml")
+	require.NoError(t, os.WriteFile(cfgPath, []byte(fmt.Sprintf(`
+[[Resolvers]]
+  Name = "local"
+  Type = "fs"
+  [Resolvers.Filesystem]
+    Path = %q
+
+[[Routes]]
+  Path = "/minimal/latest"
+  Resolver = "local"
+  Key = "minimal/latest"
+`, root)), 0644))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	bs := NewIndexService(ctx)
+	require.NoError(t, bs.SetupService(cfgPath))
+
+	for i := 0; i < 20; i++ {
+		for _, p := range []string{
+			"/minimal/latest",
+			fmt.Sprintf("/minimal/height/%d", 1000+i),
+			fmt.Sprintf("/minimal/time/2020-08-25T%02d:00:00Z", i),
+			fmt.Sprintf("/probe/%d/.env", i),
+		} {
+			bs.ServiceRouter.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, p, nil))
+		}
+	}
+
+	families, err := prometheus.DefaultGatherer.Gather()
+	require.NoError(t, err)
+
+	handlers := make(map[string]bool)
+	for _, mf := range families {
+		if mf.GetName() != "http_request_duration_seconds" {
+			continue
+		}
+		for _, m := range mf.GetMetric() {
+			for _, l := range m.GetLabel() {
+				if l.GetName() == "handler" {
+					handlers[l.GetValue()] = true
+				}
+			}
+		}
+	}
+
+	// every requested path is counted under its route template, or as unmatched
+	for _, h := range []string{"/minimal/latest", "/minimal/height/{epoch:[0-9]+}", "/minimal/time/{time}", unmatchedHandler} {
+		assert.True(t, handlers[h], "handler %s", h)
+	}
+	for h := range handlers {
+		assert.NotContains(t, h, "/probe/")
+		assert.NotContains(t, h, "/height/1")
+		assert.NotContains(t, h, "/time/2020")
+	}
+	assert.LessOrEqual(t, len(handlers), 10)
+}
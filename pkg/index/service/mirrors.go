@@ -0,0 +1,82 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"path"
+	"time"
+
+	"github.com/filecoin-project/filecoin-chain-archiver/pkg/index"
+)
+
+// mirrorRegionHeader lets clients ask for a mirror in their region
+const mirrorRegionHeader = "X-Mirror-Region"
+
+// mirrorURL returns the location of key on a healthy mirror of the route.
+func (rt *route) mirrorURL(r *http.Request, key string) (string, bool) {
+	if rt.mirrors == nil {
+		return "", false
+	}
+
+	mirror, ok := rt.mirrors.Select(r.Header.Get(mirrorRegionHeader))
+	if !ok {
+		logger.Warnw("no healthy mirrors, using resolved location", "route", rt.cfg.Path)
+		return "", false
+	}
+
+	u, err := mirror.URL(key)
+	if err != nil {
+		logger.Errorw("error joining mirror url", "mirror", mirror.Prefix, "key", key, "err", err)
+		return "", false
+	}
+
+	return u, true
+}
+
+// checkMirrors checks the mirrors of the route hold the latest snapshot every interval until ctx is done.
+func (bs *IndexService) checkMirrors(ctx context.Context, rt *route, interval, timeout time.Duration) {
+	check := func() {
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+
+		location, err := rt.resolver.Resolve(ctx, rt.cfg.Key)
+		if err != nil {
+			logger.Warnw("error resolving latest for mirror checks", "route", rt.cfg.Path, "err", err)
+			return
+		}
+
+		u, err := url.Parse(location)
+		if err != nil {
+			logger.Warnw("error parsing latest for mirror checks", "route", rt.cfg.Path, "location", location, "err", err)
+			return
+		}
+
+		rt.mirrors.Check(ctx, rt.prefix+path.Base(u.Path))
+
+		for _, h := range rt.mirrors.Health() {
+			v := 0.0
+			if h.Healthy {
+				v = 1
+			}
+			mirrorHealthy.WithLabelValues(rt.cfg.Path, h.Prefix).Set(v)
+		}
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		check()
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func newMirrorSet(mirrors []index.Mirror, timeout time.Duration) *index.MirrorSet {
+	return index.NewMirrorSet(mirrors, &http.Client{Timeout: timeout})
+}
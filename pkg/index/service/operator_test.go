@@ -0,0 +1,77 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	cliutil "github.com/filecoin-project/lotus/cli/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/filecoin-chain-archiver/pkg/index/api/apiclient"
+)
+
+func TestOperatorPermissions(t *testing.T) {
+	tokenPath := filepath.Join(t.TempDir(), "operator-token")
+	require.NoError(t, os.WriteFile(tokenPath, []byte("a1b2.c3d4.e5f6\n"), 0600))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	bs := NewIndexService(ctx)
+	require.NoError(t, bs.SetupOperator(tokenPath))
+
+	srv := httptest.NewServer(bs.OperatorRouter)
+	defer srv.Close()
+
+	client := func(apiInfo string) func(string) error {
+		ai := cliutil.ParseApiInfo(apiInfo)
+		addr, err := ai.DialArgs("v0")
+		require.NoError(t, err)
+
+		operator, closer, err := apiclient.NewOperatorClient(ctx, addr, ai.AuthHeader())
+		require.NoError(t, err)
+		t.Cleanup(closer)
+
+		return func(method string) error {
+			switch method {
+			case "version":
+				_, err := operator.Version(ctx)
+				return err
+			case "log-list":
+				_, err := operator.LogList(ctx)
+				return err
+			case "log-set-level":
+				return operator.LogSetLevel(ctx, "filecoin-chain-archiver/service/index-resolver", "info")
+			case "cache-flush":
+				return operator.CacheFlush(ctx)
+			}
+			panic(method)
+		}
+	}
+
+	// requests without a token may only read
+	anonymous := client(srv.URL)
+	assert.NoError(t, anonymous("version"))
+	for _, method := range []string{"log-list", "log-set-level", "cache-flush"} {
+		assert.Error(t, anonymous(method), method)
+	}
+
+	authorized := client("a1b2.c3d4.e5f6:" + srv.URL)
+	for _, method := range []string{"version", "log-list", "log-set-level", "cache-flush"} {
+		assert.NoError(t, authorized(method), method)
+	}
+
+	// tokens which can not be passed in api info are refused
+	require.NoError(t, os.WriteFile(tokenPath, []byte("secret\n"), 0600))
+	assert.Error(t, NewIndexService(ctx).SetupOperator(tokenPath))
+
+	resp, err := http.Get(srv.URL + "/liveness")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
@@ -0,0 +1,103 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+
+	"github.com/filecoin-project/filecoin-chain-archiver/pkg/config"
+	"github.com/filecoin-project/filecoin-chain-archiver/pkg/index"
+)
+
+// serveLocation redirects to location, or to a mirror of it, or serves the object it refers to from storage when
+// the route proxies or presigns.
+func (bs *IndexService) serveLocation(w http.ResponseWriter, r *http.Request, rt *route, location string) {
+	if rt.cfg.Mode == config.RouteModeRedirect && rt.mirrors == nil {
+		w.Header().Set("Location", location)
+		w.WriteHeader(http.StatusFound)
+		return
+	}
+
+	u, err := url.Parse(location)
+	if err != nil {
+		logger.Errorw("error parsing location", "location", location, "err", err)
+		w.WriteHeader(http.StatusBadGateway)
+		return
+	}
+
+	// locations are written as the retrieval endpoint prefix joined with the object key, and snapshots are stored
+	// next to the latest object
+	key := rt.prefix + path.Base(u.Path)
+
+	if rt.cfg.Mode == config.RouteModeRedirect {
+		if mirrored, ok := rt.mirrorURL(r, key); ok {
+			location = mirrored
+		}
+
+		w.Header().Add("Vary", mirrorRegionHeader)
+		w.Header().Set("Location", location)
+		w.WriteHeader(http.StatusFound)
+		return
+	}
+
+	bs.serveObject(w, r, rt, key)
+}
+
+// serveObject serves the object at key when the route proxies or presigns.
+func (bs *IndexService) serveObject(w http.ResponseWriter, r *http.Request, rt *route, key string) {
+	switch rt.cfg.Mode {
+	case config.RouteModeProxy:
+		bs.proxyObject(w, r, rt, key)
+	case config.RouteModePresign:
+		bs.presignObject(w, r, rt, key)
+	}
+}
+
+// presignObject redirects to a presigned URL of the object at key. URLs are signed locally, the object is not
+// checked to exist.
+func (bs *IndexService) presignObject(w http.ResponseWriter, r *http.Request, rt *route, key string) {
+	location, err := rt.presigner.Presign(r.Context(), key, rt.cfg.PresignExpiry)
+	if err != nil {
+		logger.Errorw("error presigning object", "key", key, "err", err)
+		w.WriteHeader(http.StatusBadGateway)
+		return
+	}
+
+	// presigned URLs expire, so the redirect must not outlive them in caches
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Location", location)
+	w.WriteHeader(http.StatusFound)
+}
+
+// proxyObject streams the object at key from storage. Range, conditional and HEAD requests are handled by
+// http.ServeContent.
+func (bs *IndexService) proxyObject(w http.ResponseWriter, r *http.Request, rt *route, key string) {
+	object, err := rt.objects.Open(r.Context(), key)
+	if err != nil {
+		if errors.Is(err, index.ErrObjectNotFound) {
+			http.Error(w, "snapshot not found", http.StatusNotFound)
+			return
+		}
+
+		logger.Errorw("error opening object", "key", key, "err", err)
+		w.WriteHeader(http.StatusBadGateway)
+		return
+	}
+	defer object.Close()
+
+	name := path.Base(key)
+
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s", strconv.Quote(name)))
+	if object.ETag != "" {
+		w.Header().Set("ETag", strconv.Quote(object.ETag))
+	}
+	if object.ContentType != "" {
+		w.Header().Set("Content-Type", object.ContentType)
+	}
+
+	releaseConcurrency(r)
+	http.ServeContent(w, r, name, object.ModTime, object)
+}
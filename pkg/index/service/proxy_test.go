@@ -0,0 +1,207 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/filecoin-chain-archiver/pkg/config"
+	"github.com/filecoin-project/filecoin-chain-archiver/pkg/index"
+)
+
+type memoryObjectStore map[string][]byte
+
+type nopSeekCloser struct {
+	io.ReadSeeker
+}
+
+func (nopSeekCloser) Close() error { return nil }
+
+func (m memoryObjectStore) Open(ctx context.Context, key string) (*index.Object, error) {
+	data, ok := m[key]
+	if !ok {
+		return nil, index.ErrObjectNotFound
+	}
+
+	return &index.Object{
+		ReadSeekCloser: nopSeekCloser{bytes.NewReader(data)},
+		Key:            key,
+		Size:           int64(len(data)),
+		ETag:           "abc",
+		ModTime:        time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC),
+	}, nil
+}
+
+func TestProxyObject(t *testing.T) {
+	bs := NewIndexService(context.Background())
+	rt := &route{
+		cfg:    config.RouteConfig{Mode: config.RouteModeProxy},
+		prefix: "minimal/",
+		objects: memoryObjectStore{
+			"minimal/1200_2020_08_25T22_00_00Z.car.zst": []byte("0123456789"),
+		},
+	}
+
+	serve := func(method, location string, header http.Header) *http.Response {
+		r := httptest.NewRequest(method, "/minimal/latest", nil)
+		for k, v := range header {
+			r.Header[k] = v
+		}
+		w := httptest.NewRecorder()
+		bs.serveLocation(w, r, rt, location)
+		return w.Result()
+	}
+
+	location := "https://example.com/minimal/1200_2020_08_25T22_00_00Z.car.zst"
+
+	resp := serve(http.MethodGet, location, nil)
+	body, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "0123456789", string(body))
+	assert.Equal(t, `"abc"`, resp.Header.Get("ETag"))
+	assert.Equal(t, `attachment; filename="1200_2020_08_25T22_00_00Z.car.zst"`, resp.Header.Get("Content-Disposition"))
+
+	resp = serve(http.MethodGet, location, http.Header{"Range": {"bytes=4-"}})
+	body, _ = io.ReadAll(resp.Body)
+	assert.Equal(t, http.StatusPartialContent, resp.StatusCode)
+	assert.Equal(t, "456789", string(body))
+	assert.Equal(t, "bytes 4-9/10", resp.Header.Get("Content-Range"))
+
+	resp = serve(http.MethodGet, location, http.Header{"If-None-Match": {`"abc"`}})
+	assert.Equal(t, http.StatusNotModified, resp.StatusCode)
+
+	resp = serve(http.MethodHead, location, nil)
+	body, _ = io.ReadAll(resp.Body)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "10", resp.Header.Get("Content-Length"))
+	assert.Empty(t, body)
+
+	resp = serve(http.MethodGet, "https://example.com/minimal/missing.car.zst", nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	// redirect mode leaves the location to the client
+	rt.cfg.Mode = config.RouteModeRedirect
+	resp = serve(http.MethodGet, location, nil)
+	require.Equal(t, http.StatusFound, resp.StatusCode)
+	assert.Equal(t, location, resp.Header.Get("Location"))
+}
+
+type fakePresigner struct{}
+
+func (fakePresigner) Presign(ctx context.Context, key string, expiry time.Duration) (string, error) {
+	return fmt.Sprintf("https://s3.example.com/bucket/%s?X-Amz-Expires=%d", key, int(expiry.Seconds())), nil
+}
+
+func TestPresignAuthorized(t *testing.T) {
+	bs := NewIndexService(context.Background())
+	rt := &route{
+		cfg:       config.RouteConfig{Mode: config.RouteModePresign, PresignExpiry: time.Hour},
+		prefix:    "minimal/",
+		presigner: fakePresigner{},
+		tokens:    clientTokens{"secret": "alice"},
+	}
+
+	handler := rt.authorize(func(w http.ResponseWriter, r *http.Request) {
+		bs.serveLocation(w, r, rt, "https://example.com/minimal/1200_2020_08_25T22_00_00Z.car.zst")
+	})
+
+	serve := func(target string, header http.Header) *http.Response {
+		r := httptest.NewRequest(http.MethodGet, target, nil)
+		for k, v := range header {
+			r.Header[k] = v
+		}
+		w := httptest.NewRecorder()
+		handler(w, r)
+		return w.Result()
+	}
+
+	resp := serve("/minimal/latest", nil)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	assert.NotEmpty(t, resp.Header.Get("WWW-Authenticate"))
+
+	resp = serve("/minimal/latest", http.Header{"Authorization": {"Bearer wrong"}})
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	for _, resp := range []*http.Response{
+		serve("/minimal/latest", http.Header{"Authorization": {"Bearer secret"}}),
+		serve("/minimal/latest?token=secret", nil),
+	} {
+		require.Equal(t, http.StatusFound, resp.StatusCode)
+		assert.Equal(t, "https://s3.example.com/bucket/minimal/1200_2020_08_25T22_00_00Z.car.zst?X-Amz-Expires=3600", resp.Header.Get("Location"))
+		assert.Equal(t, "no-store", resp.Header.Get("Cache-Control"))
+	}
+}
+
+func TestLoadClientTokens(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "tokens")
+	require.NoError(t, os.WriteFile(p, []byte("# clients\nalice: secret\n\nbob:other\n"), 0600))
+
+	tokens, err := loadClientTokens(p)
+	require.NoError(t, err)
+	assert.Equal(t, clientTokens{"secret": "alice", "other": "bob"}, tokens)
+
+	require.NoError(t, os.WriteFile(p, []byte("alice\n"), 0600))
+	_, err = loadClientTokens(p)
+	assert.Error(t, err)
+}
+
+func TestDecompress(t *testing.T) {
+	enc, err := zstd.NewWriter(nil)
+	require.NoError(t, err)
+	compressed := enc.EncodeAll([]byte("car data"), nil)
+	require.NoError(t, enc.Close())
+
+	bs := NewIndexService(context.Background())
+	sem := make(chan struct{}, 1)
+	maxWindow := uint64(config.DefaultIndexServiceConfig().Decompress.MaxWindow)
+
+	rt := &route{
+		cfg:      config.RouteConfig{Path: "/minimal/latest", Key: "minimal/latest"},
+		prefix:   "minimal/",
+		resolver: index.NewCachedResolver(staticResolver("https://example.com/minimal/1200_2020_08_25T22_00_00Z.car.zst"), index.DefaultCacheOptions()),
+		objects: memoryObjectStore{
+			"minimal/1200_2020_08_25T22_00_00Z.car.zst": compressed,
+		},
+	}
+
+	w := httptest.NewRecorder()
+	bs.decompressHandler(rt, sem, maxWindow)(w, httptest.NewRequest(http.MethodGet, "/minimal/latest.car", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "car data", w.Body.String())
+	assert.Equal(t, `attachment; filename="1200_2020_08_25T22_00_00Z.car"`, w.Header().Get("Content-Disposition"))
+
+	// downloads over the limit are refused
+	sem <- struct{}{}
+	w = httptest.NewRecorder()
+	bs.decompressHandler(rt, sem, maxWindow)(w, httptest.NewRequest(http.MethodGet, "/minimal/latest.car", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.NotEmpty(t, w.Header().Get("Retry-After"))
+	<-sem
+
+	// snapshots compressed with a window above the limit are refused before anything is sent
+	var buf bytes.Buffer
+	enc, err = zstd.NewWriter(&buf, zstd.WithWindowSize(1<<20), zstd.WithSingleSegment(false))
+	require.NoError(t, err)
+	_, err = enc.Write(bytes.Repeat([]byte("car data"), 1<<17))
+	require.NoError(t, err)
+	require.NoError(t, enc.Close())
+	rt.objects = memoryObjectStore{
+		"minimal/1200_2020_08_25T22_00_00Z.car.zst": buf.Bytes(),
+	}
+
+	w = httptest.NewRecorder()
+	bs.decompressHandler(rt, sem, 1<<16)(w, httptest.NewRequest(http.MethodGet, "/minimal/latest.car", nil))
+	assert.Equal(t, http.StatusBadGateway, w.Code)
+	assert.Contains(t, w.Body.String(), "window")
+}
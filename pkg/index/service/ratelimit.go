@@ -0,0 +1,278 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/filecoin-project/filecoin-chain-archiver/pkg/config"
+)
+
+const (
+	// forwardedForHeader lists the clients and proxies a request passed through, the last hop is appended last
+	forwardedForHeader = "X-Forwarded-For"
+	// rateLimitSweepInterval is how often the buckets of idle clients are dropped
+	rateLimitSweepInterval = time.Minute
+)
+
+// rateLimits are the limits of the rate limiter, parsed from the configuration.
+type rateLimits struct {
+	rate          float64
+	burst         int
+	maxConcurrent int
+	trusted       []*net.IPNet
+}
+
+func newRateLimits(cfg config.RateLimitConfig) (rateLimits, error) {
+	if cfg.RequestsPerSecond < 0 {
+		return rateLimits{}, fmt.Errorf("rate limit requests per second must not be negative")
+	}
+	if cfg.Burst < 0 {
+		return rateLimits{}, fmt.Errorf("rate limit burst must not be negative")
+	}
+	if cfg.MaxConcurrent < 0 {
+		return rateLimits{}, fmt.Errorf("rate limit max concurrent must not be negative")
+	}
+
+	limits := rateLimits{
+		rate:          cfg.RequestsPerSecond,
+		burst:         cfg.Burst,
+		maxConcurrent: cfg.MaxConcurrent,
+	}
+
+	if limits.burst == 0 {
+		limits.burst = 1
+	}
+
+	for _, p := range cfg.TrustedProxies {
+		if !strings.Contains(p, "/") {
+			ip := net.ParseIP(p)
+			if ip == nil {
+				return rateLimits{}, fmt.Errorf("trusted proxy %q is not an address or CIDR", p)
+			}
+
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 8 * net.IPv4len
+			}
+			limits.trusted = append(limits.trusted, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, ipnet, err := net.ParseCIDR(p)
+		if err != nil {
+			return rateLimits{}, fmt.Errorf("trusted proxy %q is not an address or CIDR: %w", p, err)
+		}
+		limits.trusted = append(limits.trusted, ipnet)
+	}
+
+	return limits, nil
+}
+
+func (l rateLimits) isTrusted(ip net.IP) bool {
+	for _, n := range l.trusted {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// fromTrustedProxy reports if the request was made by a trusted proxy, whose forwarded headers can be honoured.
+func (l rateLimits) fromTrustedProxy(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	ip := net.ParseIP(host)
+	return ip != nil && l.isTrusted(ip)
+}
+
+// clientIP returns the address of the client which made the request. Requests from trusted proxies are attributed
+// to the last address in X-Forwarded-For which is not a trusted proxy.
+func (l rateLimits) clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	if !l.fromTrustedProxy(r) {
+		return host
+	}
+
+	ip := net.ParseIP(host)
+	var hops []string
+	for _, v := range r.Header.Values(forwardedForHeader) {
+		hops = append(hops, strings.Split(v, ",")...)
+	}
+
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := net.ParseIP(strings.TrimSpace(hops[i]))
+		if hop == nil {
+			break
+		}
+
+		ip = hop
+		if !l.isTrusted(hop) {
+			break
+		}
+	}
+
+	return ip.String()
+}
+
+// bucket holds the tokens of a client, refilled at the rate of the limiter up to its burst.
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// take removes a token from the bucket, or returns how long until one is available.
+func (b *bucket) take(now time.Time, rate float64, burst int) (bool, time.Duration) {
+	b.tokens = math.Min(float64(burst), b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+
+	return false, time.Duration((1 - b.tokens) / rate * float64(time.Second))
+}
+
+// rateLimiter limits the rate of requests of each client with a token bucket, and the requests served at once.
+type rateLimiter struct {
+	mu        sync.Mutex
+	limits    rateLimits
+	clients   map[string]*bucket
+	inFlight  int
+	lastSweep time.Time
+}
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{
+		clients: make(map[string]*bucket),
+	}
+}
+
+// configure replaces the limits, keeping the buckets of the clients.
+func (l *rateLimiter) configure(limits rateLimits) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.limits = limits
+
+	rateLimit.WithLabelValues("requests_per_second").Set(limits.rate)
+	rateLimit.WithLabelValues("burst").Set(float64(limits.burst))
+	rateLimit.WithLabelValues("max_concurrent").Set(float64(limits.maxConcurrent))
+}
+
+// allow takes a token from the bucket of the client, returning how long the client should wait when it is empty.
+func (l *rateLimiter) allow(r *http.Request, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.limits.rate <= 0 {
+		return true, 0
+	}
+
+	l.sweep(now)
+
+	ip := l.limits.clientIP(r)
+	b, ok := l.clients[ip]
+	if !ok {
+		b = &bucket{tokens: float64(l.limits.burst), last: now}
+		l.clients[ip] = b
+		rateLimitClients.Set(float64(len(l.clients)))
+	}
+
+	return b.take(now, l.limits.rate, l.limits.burst)
+}
+
+// sweep drops the buckets which have refilled, as they are the same as new buckets.
+func (l *rateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < rateLimitSweepInterval {
+		return
+	}
+	l.lastSweep = now
+
+	full := time.Duration(float64(l.limits.burst) / l.limits.rate * float64(time.Second))
+	for ip, b := range l.clients {
+		if now.Sub(b.last) >= full {
+			delete(l.clients, ip)
+		}
+	}
+
+	rateLimitClients.Set(float64(len(l.clients)))
+}
+
+// acquire counts a request as being served, returning false when the concurrency limit is reached.
+func (l *rateLimiter) acquire() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.limits.maxConcurrent > 0 && l.inFlight >= l.limits.maxConcurrent {
+		return false
+	}
+
+	l.inFlight++
+	requestsInFlight.Set(float64(l.inFlight))
+
+	return true
+}
+
+func (l *rateLimiter) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.inFlight--
+	requestsInFlight.Set(float64(l.inFlight))
+}
+
+// concurrencySlotKey is the context key of the function giving back the concurrency slot of a request
+type concurrencySlotKey struct{}
+
+// middleware refuses requests over the limits with a 429 and the number of seconds to wait in Retry-After.
+func (l *rateLimiter) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ok, wait := l.allow(r, time.Now()); !ok {
+			rateLimited.WithLabelValues("client").Inc()
+			tooManyRequests(w, wait)
+			return
+		}
+
+		if !l.acquire() {
+			rateLimited.WithLabelValues("concurrency").Inc()
+			tooManyRequests(w, time.Second)
+			return
+		}
+
+		var once sync.Once
+		release := func() { once.Do(l.release) }
+		defer release()
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), concurrencySlotKey{}, release)))
+	})
+}
+
+// releaseConcurrency gives back the concurrency slot of the request. Handlers streaming snapshots call it once they
+// start streaming, so long downloads do not hold slots needed by short requests. Streams have their own limits, such
+// as Decompress.MaxConcurrent.
+func releaseConcurrency(r *http.Request) {
+	if release, ok := r.Context().Value(concurrencySlotKey{}).(func()); ok {
+		release()
+	}
+}
+
+func tooManyRequests(w http.ResponseWriter, wait time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	http.Error(w, "too many requests, try again later", http.StatusTooManyRequests)
+}
@@ -0,0 +1,161 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/filecoin-chain-archiver/pkg/config"
+)
+
+func TestClientIP(t *testing.T) {
+	limits, err := newRateLimits(config.RateLimitConfig{TrustedProxies: []string{"10.0.0.0/8", "192.0.2.1"}})
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name      string
+		remote    string
+		forwarded []string
+		expected  string
+	}{
+		{name: "direct", remote: "198.51.100.7:1234", expected: "198.51.100.7"},
+		{name: "untrusted proxy", remote: "198.51.100.7:1234", forwarded: []string{"203.0.113.5"}, expected: "198.51.100.7"},
+		{name: "trusted proxy", remote: "10.1.2.3:1234", forwarded: []string{"203.0.113.5"}, expected: "203.0.113.5"},
+		{name: "proxy chain", remote: "10.1.2.3:1234", forwarded: []string{"203.0.113.9, 203.0.113.5, 192.0.2.1"}, expected: "203.0.113.5"},
+		{name: "multiple headers", remote: "192.0.2.1:1234", forwarded: []string{"203.0.113.9", "10.4.5.6"}, expected: "203.0.113.9"},
+		{name: "malformed hop", remote: "10.1.2.3:1234", forwarded: []string{"203.0.113.9, garbage"}, expected: "10.1.2.3"},
+		{name: "no header", remote: "10.1.2.3:1234", expected: "10.1.2.3"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/minimal/latest", nil)
+			r.RemoteAddr = tc.remote
+			for _, v := range tc.forwarded {
+				r.Header.Add(forwardedForHeader, v)
+			}
+
+			assert.Equal(t, tc.expected, limits.clientIP(r))
+		})
+	}
+
+	_, err = newRateLimits(config.RateLimitConfig{TrustedProxies: []string{"proxy.example.com"}})
+	assert.Error(t, err)
+}
+
+func TestRateLimiter(t *testing.T) {
+	limits, err := newRateLimits(config.RateLimitConfig{RequestsPerSecond: 0.5, Burst: 2})
+	require.NoError(t, err)
+
+	l := newRateLimiter()
+	l.configure(limits)
+
+	request := func(remote string) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/minimal/latest", nil)
+		r.RemoteAddr = remote
+		return r
+	}
+
+	now := time.Now()
+
+	for i := 0; i < 2; i++ {
+		ok, _ := l.allow(request("198.51.100.7:1234"), now)
+		assert.True(t, ok, "requests up to the burst are allowed")
+	}
+
+	ok, wait := l.allow(request("198.51.100.7:1234"), now)
+	assert.False(t, ok)
+	assert.Equal(t, 2*time.Second, wait)
+
+	ok, _ = l.allow(request("198.51.100.8:1234"), now)
+	assert.True(t, ok, "clients are limited separately")
+
+	ok, _ = l.allow(request("198.51.100.7:1234"), now.Add(2*time.Second))
+	assert.True(t, ok, "buckets refill at the rate")
+
+	// buckets of idle clients are dropped once they have refilled
+	l.allow(request("198.51.100.8:1234"), now.Add(2*rateLimitSweepInterval))
+	assert.Len(t, l.clients, 1)
+}
+
+func TestRateLimiterMiddleware(t *testing.T) {
+	limits, err := newRateLimits(config.RateLimitConfig{RequestsPerSecond: 1, Burst: 1, MaxConcurrent: 1})
+	require.NoError(t, err)
+
+	l := newRateLimiter()
+	l.configure(limits)
+
+	release := make(chan struct{})
+	started := make(chan struct{})
+	handler := l.middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	}))
+
+	request := func(remote string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/minimal/latest", nil)
+		r.RemoteAddr = remote
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		request("198.51.100.7:1234")
+	}()
+	<-started
+
+	w := request("198.51.100.7:1234")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "1", w.Header().Get("Retry-After"))
+
+	// another client is within its rate but over the concurrency limit
+	w = request("198.51.100.8:1234")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "1", w.Header().Get("Retry-After"))
+
+	close(release)
+	<-done
+	assert.Equal(t, 0, l.inFlight)
+}
+
+func TestRateLimiterStreamsReleaseConcurrency(t *testing.T) {
+	limits, err := newRateLimits(config.RateLimitConfig{MaxConcurrent: 1})
+	require.NoError(t, err)
+
+	l := newRateLimiter()
+	l.configure(limits)
+
+	release := make(chan struct{})
+	started := make(chan struct{})
+	stream := l.middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		releaseConcurrency(r)
+		// releasing more than once gives back a single slot
+		releaseConcurrency(r)
+		close(started)
+		<-release
+	}))
+	short := l.middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		stream.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/minimal/latest.car", nil))
+	}()
+	<-started
+
+	// a stream does not hold a slot once it has started
+	w := httptest.NewRecorder()
+	short.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/minimal/latest", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	close(release)
+	<-done
+	assert.Equal(t, 0, l.inFlight)
+}
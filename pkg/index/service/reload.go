@@ -0,0 +1,160 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/filecoin-project/filecoin-chain-archiver/pkg/config"
+)
+
+// state is what the service serves for one version of its configuration. A state is not modified once it is being
+// served, reloading the configuration builds a new one.
+type state struct {
+	router    *mux.Router
+	routes    []*route
+	freshness config.FreshnessConfig
+	limits    rateLimits
+
+	// decompressSem bounds the decompressed downloads served at once
+	decompressSem chan struct{}
+	// decompressMaxWindow is the largest zstd window decoded, it bounds the memory of each decompressed download
+	decompressMaxWindow uint64
+
+	// cancel stops the background checks of the routes
+	cancel context.CancelFunc
+}
+
+func newState() *state {
+	return &state{
+		router: mux.NewRouter(),
+		cancel: func() {},
+	}
+}
+
+// current returns the state being served.
+func (bs *IndexService) current() *state {
+	bs.stateMu.RLock()
+	defer bs.stateMu.RUnlock()
+	return bs.state
+}
+
+// serveCurrent passes requests to the router of the state being served. Requests which have started are finished
+// by the router they started on.
+func (bs *IndexService) serveCurrent(w http.ResponseWriter, r *http.Request) {
+	bs.current().router.ServeHTTP(w, r)
+}
+
+// loadState reads the configuration at configPath and builds the routes it defines, including reading the
+// credentials of the resolvers again.
+func (bs *IndexService) loadState(configPath string) (*state, error) {
+	icfg, err := config.FromFile(configPath, config.DefaultIndexServiceConfig())
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := icfg.(*config.IndexServiceConfig)
+
+	if cfg.Freshness.Interval <= 0 {
+		return nil, fmt.Errorf("freshness interval must be positive")
+	}
+	if cfg.MirrorCheck.Interval <= 0 {
+		return nil, fmt.Errorf("mirror check interval must be positive")
+	}
+	if cfg.Decompress.MaxConcurrent <= 0 {
+		return nil, fmt.Errorf("decompress max concurrent must be positive")
+	}
+	if cfg.Decompress.MaxWindow < zstd.MinWindowSize || cfg.Decompress.MaxWindow > zstd.MaxWindowSize {
+		return nil, fmt.Errorf("decompress max window must be between %d and %d bytes", zstd.MinWindowSize, zstd.MaxWindowSize)
+	}
+
+	limits, err := newRateLimits(cfg.RateLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	st := newState()
+	st.freshness = cfg.Freshness
+	st.limits = limits
+	st.decompressSem = make(chan struct{}, cfg.Decompress.MaxConcurrent)
+	st.decompressMaxWindow = uint64(cfg.Decompress.MaxWindow)
+
+	resolvers, err := bs.setupResolvers(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(bs.ctx)
+	if err := bs.setupRoutes(ctx, st, cfg, resolvers); err != nil {
+		cancel()
+		return nil, err
+	}
+	st.cancel = cancel
+
+	return st, nil
+}
+
+// swapState serves st in place of the current state, stopping the background checks of the current state.
+func (bs *IndexService) swapState(st *state) {
+	bs.stateMu.Lock()
+	old := bs.state
+	bs.state = st
+	bs.stateMu.Unlock()
+
+	bs.limiter.configure(st.limits)
+
+	old.cancel()
+	forgetRouteMetrics(old.routes, st.routes)
+}
+
+// Reload reads the configuration again and serves the routes it defines. The current configuration keeps being
+// served when the new one fails to load.
+func (bs *IndexService) Reload() error {
+	st, err := bs.loadState(bs.configPath)
+	if err != nil {
+		configReloads.WithLabelValues("failed").Inc()
+		return err
+	}
+
+	bs.swapState(st)
+	configReloads.WithLabelValues("succeeded").Inc()
+
+	logger.Infow("configuration reloaded", "path", bs.configPath, "routes", len(st.routes))
+
+	return bs.dumpRoutes(st.router)
+}
+
+// forgetRouteMetrics drops the metrics of the routes and mirrors which are no longer served.
+func forgetRouteMetrics(old, current []*route) {
+	served := make(map[string]map[string]bool)
+	for _, rt := range current {
+		mirrors := make(map[string]bool)
+		if rt.mirrors != nil {
+			for _, h := range rt.mirrors.Health() {
+				mirrors[h.Prefix] = true
+			}
+		}
+		served[rt.cfg.Path] = mirrors
+	}
+
+	for _, rt := range old {
+		mirrors, ok := served[rt.cfg.Path]
+		if !ok {
+			snapshotAge.DeleteLabelValues(rt.cfg.Path)
+			snapshotHeight.DeleteLabelValues(rt.cfg.Path)
+		}
+
+		if rt.mirrors == nil {
+			continue
+		}
+
+		for _, h := range rt.mirrors.Health() {
+			if !mirrors[h.Prefix] {
+				mirrorHealthy.DeleteLabelValues(rt.cfg.Path, h.Prefix)
+			}
+		}
+	}
+}
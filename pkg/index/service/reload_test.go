@@ -0,0 +1,85 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReload(t *testing.T) {
+	root := t.TempDir()
+	for key, location := range map[string]string{
+		"minimal/latest": "https://example.com/minimal/1200_2020_08_25T22_00_00Z.car.zst",
+		"full/latest":    "https://example.com/full/1200_2020_08_25T22_00_00Z.car.zst",
+	} {
+		p := filepath.Join(root, key)
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0755))
+		require.NoError(t, os.WriteFile(p, []byte(location), 0644))
+	}
+
+	cfgPath := filepath.Join(t.TempDir(), "config.toml")
+	writeConfig := func(routes ...string) {
+		cfg := fmt.Sprintf(`
+[[Resolvers]]
+  Name = "local"
+  Type = "fs"
+  [Resolvers.Filesystem]
+    Path = %q
+`, root)
+		for _, key := range routes {
+			cfg += fmt.Sprintf(`
+[[Routes]]
+  Path = "/%s"
+  Resolver = "local"
+  Key = "%s"
+`, key, key)
+		}
+		require.NoError(t, os.WriteFile(cfgPath, []byte(cfg), 0644))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	writeConfig("minimal/latest")
+
+	bs := NewIndexService(ctx)
+	require.NoError(t, bs.SetupService(cfgPath))
+
+	srv := httptest.NewServer(bs.ServiceRouter)
+	defer srv.Close()
+
+	status := func(p string) int {
+		client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+		resp, err := client.Get(srv.URL + p)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	assert.Equal(t, http.StatusFound, status("/minimal/latest"))
+	assert.Equal(t, http.StatusNotFound, status("/full/latest"))
+
+	writeConfig("minimal/latest", "full/latest")
+	require.NoError(t, bs.Reload())
+
+	assert.Equal(t, http.StatusFound, status("/minimal/latest"))
+	assert.Equal(t, http.StatusFound, status("/full/latest"))
+	assert.Len(t, bs.current().routes, 2)
+
+	// configurations which fail to load leave the current routes in place
+	require.NoError(t, os.WriteFile(cfgPath, []byte("[[Routes]\n"), 0644))
+	assert.Error(t, bs.Reload())
+
+	writeConfig("minimal/latest", "minimal/latest")
+	assert.Error(t, bs.Reload())
+
+	assert.Equal(t, http.StatusFound, status("/full/latest"))
+	assert.Len(t, bs.current().routes, 2)
+}
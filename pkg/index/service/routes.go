@@ -0,0 +1,432 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/filecoin-project/filecoin-chain-archiver/pkg/config"
+	"github.com/filecoin-project/filecoin-chain-archiver/pkg/index"
+	"github.com/filecoin-project/filecoin-chain-archiver/pkg/index/api"
+)
+
+// route serves the latest snapshot for a single key, along with the listing and lookup of the snapshots stored next
+// to it.
+type route struct {
+	cfg config.RouteConfig
+
+	// base is the parent path of the route, eg: /minimal
+	base string
+	// prefix is the parent key of the latest object, eg: minimal/
+	prefix string
+
+	resolver  *index.CachedResolver
+	lister    *index.CachedLister
+	snapshots *index.SnapshotIndex
+	objects   index.ObjectStore
+	presigner index.Presigner
+	// mirrors is nil when the route has none
+	mirrors *index.MirrorSet
+
+	// tokens of the clients allowed to use the route, nil when the route is public
+	tokens clientTokens
+
+	// listing is the first route under base, which serves the listing and lookup routes of every route under it
+	listing *route
+	// browse is the page of the snapshots under base, shared by the routes under the same base
+	browse *pageCache
+
+	freshMu sync.Mutex
+	fresh   freshness
+}
+
+// maxPresignExpiry is the longest expiry S3 allows for presigned URLs
+const maxPresignExpiry = 7 * 24 * time.Hour
+
+func newRoute(rcfg config.RouteConfig, resolvers map[string]*backend, cfg *config.IndexServiceConfig) (*route, error) {
+	if !strings.HasPrefix(rcfg.Path, "/") {
+		return nil, fmt.Errorf("route %q: path must start with /", rcfg.Path)
+	}
+
+	if rcfg.Key == "" {
+		return nil, fmt.Errorf("route %q: key is required", rcfg.Path)
+	}
+
+	switch rcfg.Mode {
+	case "":
+		rcfg.Mode = config.RouteModeRedirect
+	case config.RouteModeRedirect, config.RouteModeProxy, config.RouteModePresign:
+	default:
+		return nil, fmt.Errorf("route %q: unknown mode %q", rcfg.Path, rcfg.Mode)
+	}
+
+	if rcfg.PresignExpiry == 0 {
+		rcfg.PresignExpiry = config.DefaultPresignExpiry
+	}
+	if rcfg.PresignExpiry < time.Second || rcfg.PresignExpiry > maxPresignExpiry {
+		return nil, fmt.Errorf("route %q: presign expiry must be between 1s and %s", rcfg.Path, maxPresignExpiry)
+	}
+
+	name := rcfg.Resolver
+	if name == "" {
+		name = config.DefaultResolverName
+	}
+
+	b, ok := resolvers[name]
+	if !ok {
+		return nil, fmt.Errorf("route %q: resolver %q is not configured", rcfg.Path, name)
+	}
+
+	if rcfg.Mode == config.RouteModePresign && b.presigner == nil {
+		return nil, fmt.Errorf("route %q: resolver %q can not presign, only s3 resolvers can", rcfg.Path, name)
+	}
+
+	rt := &route{
+		cfg:      rcfg,
+		base:     strings.TrimSuffix(path.Dir(rcfg.Path), "/"),
+		resolver: index.NewCachedResolver(b.resolver(rcfg.Bucket), cacheOptions(cfg.Cache)),
+		lister:   index.NewCachedLister(b.lister(rcfg.Bucket), cacheOptions(cfg.Cache)),
+		objects:  b.objects(rcfg.Bucket),
+	}
+
+	if b.presigner != nil {
+		rt.presigner = b.presigner(rcfg.Bucket)
+	}
+
+	if len(rcfg.Mirrors) > 0 {
+		if rcfg.Mode != config.RouteModeRedirect {
+			return nil, fmt.Errorf("route %q: mirrors are only used by the redirect mode", rcfg.Path)
+		}
+
+		var mirrors []index.Mirror
+		for _, m := range rcfg.Mirrors {
+			if _, err := url.ParseRequestURI(m.Prefix); err != nil {
+				return nil, fmt.Errorf("route %q: mirror %q: %w", rcfg.Path, m.Prefix, err)
+			}
+			if m.Weight < 0 {
+				return nil, fmt.Errorf("route %q: mirror %q: weight must not be negative", rcfg.Path, m.Prefix)
+			}
+
+			mirrors = append(mirrors, index.Mirror{
+				Prefix: m.Prefix,
+				Weight: m.Weight,
+				Region: m.Region,
+			})
+		}
+		rt.mirrors = newMirrorSet(mirrors, cfg.MirrorCheck.Timeout)
+	}
+
+	if rcfg.TokensPath != "" {
+		tokens, err := loadClientTokens(rcfg.TokensPath)
+		if err != nil {
+			return nil, fmt.Errorf("route %q: %w", rcfg.Path, err)
+		}
+		rt.tokens = tokens
+	}
+
+	if dir := path.Dir(rcfg.Key); dir != "." {
+		rt.prefix = dir + "/"
+	}
+
+	rt.snapshots = index.NewSnapshotIndex(rt.lister, rt.prefix, cfg.SnapshotIndexRefreshInterval)
+
+	return rt, nil
+}
+
+func cacheOptions(cfg config.CacheConfig) index.CacheOptions {
+	return index.CacheOptions{
+		TTL:        cfg.TTL,
+		MaxStale:   cfg.MaxStale,
+		MaxEntries: cfg.MaxEntries,
+	}
+}
+
+// setupRoutes registers the routes of cfg on the router of st. Background checks of the routes run until ctx is done.
+func (bs *IndexService) setupRoutes(ctx context.Context, st *state, cfg *config.IndexServiceConfig, resolvers map[string]*backend) error {
+	paths := make(map[string]struct{})
+	register := func(p string, handler http.HandlerFunc, methods ...string) error {
+		if _, ok := paths[p]; ok {
+			return fmt.Errorf("path %q is configured more than once", p)
+		}
+		paths[p] = struct{}{}
+
+		r := st.router.HandleFunc(p, handler)
+		if len(methods) > 0 {
+			r.Methods(methods...)
+		}
+		return nil
+	}
+
+	// routes sharing a parent path share the listing and lookup routes of the first route, so they must also share
+	// the key prefix
+	listings := make(map[string]*route)
+
+	for _, rcfg := range cfg.Routes {
+		rt, err := newRoute(rcfg, resolvers, cfg)
+		if err != nil {
+			return err
+		}
+
+		listing, listed := listings[rt.base]
+		if !listed {
+			listing = rt
+			listing.browse = &pageCache{ttl: cfg.Cache.TTL}
+			listings[rt.base] = listing
+		}
+		rt.listing = listing
+		rt.browse = listing.browse
+
+		st.routes = append(st.routes, rt)
+
+		if rt.mirrors != nil {
+			go bs.checkMirrors(ctx, rt, cfg.MirrorCheck.Interval, cfg.MirrorCheck.Timeout)
+		}
+
+		if cfg.Freshness.MaxAge > 0 {
+			go bs.checkFreshness(ctx, rt, cfg.Freshness.Interval)
+		}
+
+		if err := register(rt.cfg.Path, rt.authorize(bs.latestHandler(rt))); err != nil {
+			return err
+		}
+
+		for _, suffix := range []string{index.ChecksumSuffix, index.ManifestSuffix} {
+			if err := register(rt.cfg.Path+suffix, rt.authorize(bs.companionHandler(rt, suffix))); err != nil {
+				return err
+			}
+		}
+
+		if rt.cfg.Decompress {
+			if err := register(rt.cfg.Path+CarSuffix, rt.authorize(bs.decompressHandler(rt, st.decompressSem, st.decompressMaxWindow)), http.MethodGet, http.MethodHead); err != nil {
+				return err
+			}
+		}
+
+		for _, alias := range rt.cfg.Aliases {
+			if err := register(alias, aliasHandler(rt.cfg.Path)); err != nil {
+				return err
+			}
+		}
+
+		if listed {
+			if listing.prefix != rt.prefix {
+				return fmt.Errorf("route %q: routes under %s/ must share the same key prefix", rt.cfg.Path, rt.base)
+			}
+			continue
+		}
+
+		go rt.snapshots.Run(ctx)
+
+		if err := register(rt.base+"/", rt.authorize(bs.browseHandler(rt, rt.browse)), http.MethodGet, http.MethodHead); err != nil {
+			return err
+		}
+		if err := register(rt.base+"/snapshots", rt.authorize(bs.snapshotsHandler(rt.lister, rt.prefix)), http.MethodGet); err != nil {
+			return err
+		}
+		if err := register(rt.base+"/height/{epoch:[0-9]+}", rt.authorize(bs.heightHandler(rt))); err != nil {
+			return err
+		}
+		if err := register(rt.base+"/time/{time}", rt.authorize(bs.timeHandler(rt))); err != nil {
+			return err
+		}
+	}
+
+	return register("/health/freshness", bs.freshnessHandler, http.MethodGet)
+}
+
+// aliasHandler redirects to target, keeping the query so tokens passed as ?token= still authorize the request.
+func aliasHandler(target string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		location := target
+		if r.URL.RawQuery != "" {
+			location += "?" + r.URL.RawQuery
+		}
+
+		http.Redirect(w, r, location, http.StatusMovedPermanently)
+	}
+}
+
+// latestHandler serves the latest snapshot, or describes it when the request accepts json.
+func (bs *IndexService) latestHandler(rt *route) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		value, err := rt.resolver.Resolve(context.Background(), rt.cfg.Key)
+		if err != nil {
+			logger.Errorw("error resolving", "key", rt.cfg.Key, "err", err)
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+
+		w.Header().Add("Vary", "Accept")
+		if wantsJSON(r) {
+			bs.serveMetadata(w, r, rt, value)
+			return
+		}
+
+		bs.serveLocation(w, r, rt, value)
+	}
+}
+
+// companionHandler serves the object stored next to the latest snapshot, such as its checksum. Both are found
+// from a single resolution of the latest object, so they always refer to the same snapshot.
+func (bs *IndexService) companionHandler(rt *route, suffix string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		value, err := rt.resolver.Resolve(context.Background(), rt.cfg.Key)
+		if err != nil {
+			logger.Errorw("error resolving", "key", rt.cfg.Key, "err", err)
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+
+		location, err := index.CompanionURL(value, suffix)
+		if err != nil {
+			logger.Errorw("error finding companion", "key", rt.cfg.Key, "suffix", suffix, "err", err)
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+
+		bs.serveLocation(w, r, rt, location)
+	}
+}
+
+// routesForKey returns the routes which resolve key.
+func (bs *IndexService) routesForKey(key string) []*route {
+	var routes []*route
+	for _, rt := range bs.current().routes {
+		if rt.cfg.Key == key {
+			routes = append(routes, rt)
+		}
+	}
+
+	return routes
+}
+
+// listingsOf returns the routes serving the listings of routes, once each.
+func listingsOf(routes []*route) []*route {
+	var listings []*route
+	seen := make(map[*route]struct{})
+	for _, rt := range routes {
+		if _, ok := seen[rt.listing]; ok {
+			continue
+		}
+		seen[rt.listing] = struct{}{}
+		listings = append(listings, rt.listing)
+	}
+
+	return listings
+}
+
+// CacheInvalidate drops the cached value of key, along with the listing and browse page of the snapshots next to it.
+func (bs *IndexService) CacheInvalidate(ctx context.Context, key string) error {
+	routes := bs.routesForKey(key)
+	if len(routes) == 0 {
+		return fmt.Errorf("no route resolves key %q", key)
+	}
+
+	for _, rt := range routes {
+		rt.resolver.Invalidate(key)
+	}
+
+	// the listing of a base is served by its first route, which may not resolve key
+	for _, rt := range listingsOf(routes) {
+		rt.lister.Invalidate(rt.prefix)
+		rt.browse.flush()
+	}
+
+	return nil
+}
+
+// CacheRefresh resolves key again, replacing the cached value, and refreshes the listing and browse page of the
+// snapshots next to it.
+func (bs *IndexService) CacheRefresh(ctx context.Context, key string) (string, error) {
+	routes := bs.routesForKey(key)
+	if len(routes) == 0 {
+		return "", fmt.Errorf("no route resolves key %q", key)
+	}
+
+	var value string
+	for _, rt := range routes {
+		v, err := rt.resolver.Refresh(ctx, key)
+		if err != nil {
+			return "", err
+		}
+		value = v
+	}
+
+	// the listing of a base is served by its first route, which may not resolve key
+	for _, rt := range listingsOf(routes) {
+		rt.lister.Invalidate(rt.prefix)
+		rt.browse.flush()
+		go func(rt *route) {
+			if err := rt.snapshots.Refresh(bs.ctx); err != nil {
+				logger.Errorw("error refreshing snapshot index", "prefix", rt.prefix, "err", err)
+			}
+		}(rt)
+	}
+
+	return value, nil
+}
+
+// CacheList returns the cached values of every route.
+func (bs *IndexService) CacheList(ctx context.Context) ([]api.RouteCache, error) {
+	routes := bs.current().routes
+
+	caches := make([]api.RouteCache, 0, len(routes))
+	for _, rt := range routes {
+		caches = append(caches, api.RouteCache{
+			Path:    rt.cfg.Path,
+			Entries: rt.resolver.Entries(),
+		})
+	}
+
+	return caches, nil
+}
+
+// CacheFlush drops every cached value, listing and browse page.
+func (bs *IndexService) CacheFlush(ctx context.Context) error {
+	for _, rt := range bs.current().routes {
+		rt.resolver.Flush()
+		rt.lister.Flush()
+		rt.browse.flush()
+	}
+
+	return nil
+}
+
+// Resolved returns the value each route currently serves, resolving it when it is not cached.
+func (bs *IndexService) Resolved(ctx context.Context) ([]api.Resolved, error) {
+	routes := bs.current().routes
+
+	resolved := make([]api.Resolved, 0, len(routes))
+	for _, rt := range routes {
+		r := api.Resolved{
+			Path:     rt.cfg.Path,
+			Key:      rt.cfg.Key,
+			Resolver: rt.cfg.Resolver,
+		}
+		if r.Resolver == "" {
+			r.Resolver = config.DefaultResolverName
+		}
+
+		value, err := rt.resolver.Resolve(ctx, rt.cfg.Key)
+		if err != nil {
+			r.Error = err.Error()
+		} else {
+			r.Value = value
+		}
+
+		for _, e := range rt.resolver.Entries() {
+			if e.Key == rt.cfg.Key {
+				r.Expiry = e.Expiry
+			}
+		}
+
+		resolved = append(resolved, r)
+	}
+
+	return resolved, nil
+}
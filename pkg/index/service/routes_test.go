@@ -0,0 +1,75 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAliasToken(t *testing.T) {
+	location := "https://example.com/minimal/1200_2020_08_25T22_00_00Z.car.zst"
+
+	root := t.TempDir()
+	p := filepath.Join(root, "minimal/latest")
+	require.NoError(t, os.MkdirAll(filepath.Dir(p), 0755))
+	require.NoError(t, os.WriteFile(p, []byte(location), 0644))
+
+	tokensPath := filepath.Join(t.TempDir(), "tokens")
+	require.NoError(t, os.WriteFile(tokensPath, []byte("alice:secret\n"), 0600))
+
+	cfgPath := filepath.Join(t.TempDir(), "config.toml")
+	require.NoError(t, os.WriteFile(cfgPath, []byte(fmt.Sprintf(`
+[[Resolvers]]
+  Name = "local"
+  Type = "fs"
+  [Resolvers.Filesystem]
+    Path = %q
+
+[[Routes]]
+  Path = "/minimal/latest"
+  Resolver = "local"
+  Key = "minimal/latest"
+  Aliases = ["/minimal/latest.zst"]
+  TokensPath = %q
+`, root, tokensPath)), 0644))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	bs := NewIndexService(ctx)
+	require.NoError(t, bs.SetupService(cfgPath))
+
+	srv := httptest.NewServer(bs.ServiceRouter)
+	defer srv.Close()
+
+	var redirects []string
+	client := &http.Client{CheckRedirect: func(r *http.Request, via []*http.Request) error {
+		redirects = append(redirects, r.URL.String())
+		if !strings.HasPrefix(r.URL.String(), srv.URL) {
+			return http.ErrUseLastResponse
+		}
+		return nil
+	}}
+
+	resp, err := client.Get(srv.URL + "/minimal/latest.zst?token=secret")
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	// the alias keeps the token, so the route it redirects to authorizes the request
+	assert.Equal(t, http.StatusFound, resp.StatusCode)
+	assert.Equal(t, location, resp.Header.Get("Location"))
+	assert.Equal(t, []string{srv.URL + "/minimal/latest?token=secret", location}, redirects)
+
+	resp, err = client.Get(srv.URL + "/minimal/latest.zst")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
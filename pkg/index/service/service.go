@@ -2,6 +2,8 @@ package service
 
 import (
 	"context"
+	"crypto/subtle"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -10,18 +12,18 @@ import (
 	"sync"
 
 	"github.com/filecoin-project/go-jsonrpc"
+	"github.com/filecoin-project/go-jsonrpc/auth"
+	cliutil "github.com/filecoin-project/lotus/cli/util"
 	"github.com/gorilla/mux"
 	"github.com/ipfs/go-log/v2"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
-	metrics "github.com/slok/go-http-metrics/metrics/prometheus"
-	"github.com/slok/go-http-metrics/middleware"
-	"github.com/slok/go-http-metrics/middleware/std"
 
 	"github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
 
 	"github.com/filecoin-project/filecoin-chain-archiver/pkg/config"
-	"github.com/filecoin-project/filecoin-chain-archiver/pkg/index"
+	"github.com/filecoin-project/filecoin-chain-archiver/pkg/index/api"
+	"github.com/filecoin-project/filecoin-chain-archiver/pkg/index/operator"
 )
 
 var logger = log.Logger("filecoin-chain-archiver/service/index-resolver")
@@ -36,7 +38,12 @@ type IndexService struct {
 	ready   bool
 	readyMu sync.Mutex
 
-	resolver index.Resolver
+	configPath string
+
+	stateMu sync.RWMutex
+	state   *state
+
+	limiter *rateLimiter
 }
 
 func NewIndexService(ctx context.Context) *IndexService {
@@ -45,60 +52,48 @@ func NewIndexService(ctx context.Context) *IndexService {
 		ServiceRouter:  mux.NewRouter(),
 		OperatorRouter: mux.NewRouter(),
 		rpc:            jsonrpc.NewServer(),
+		state:          newState(),
+		limiter:        newRateLimiter(),
 	}
 }
 
 func loggingMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		logger.Infow("request", "uri", r.RequestURI)
+		uri := r.RequestURI
+		if r.URL.Query().Has("token") {
+			q := r.URL.Query()
+			q.Set("token", "redacted")
+			uri = r.URL.Path + "?" + q.Encode()
+		}
+		logger.Infow("request", "uri", uri)
 		next.ServeHTTP(w, r)
 	})
 }
 
 func (bs *IndexService) SetupService(configPath string) error {
 	defer bs.setReady()
-	mdlw := middleware.New(middleware.Config{
-		Recorder: metrics.NewRecorder(metrics.Config{}),
-	})
-	bs.ServiceRouter.Use(std.HandlerProvider("", mdlw))
+	bs.ServiceRouter.Use(bs.metricsMiddleware)
 	bs.ServiceRouter.Use(loggingMiddleware)
+	bs.ServiceRouter.Use(bs.limiter.middleware)
 
-	icfg, err := config.FromFile(configPath, config.DefaultIndexServiceConfig())
-	if err != nil {
-		return err
-	}
-
-	cfg := icfg.(*config.IndexServiceConfig)
+	// the routes are served through the current state so they can be replaced when the configuration is reloaded
+	bs.ServiceRouter.PathPrefix("/").HandlerFunc(bs.serveCurrent)
 
-	if err := bs.setupResolver(cfg); err != nil {
+	st, err := bs.loadState(configPath)
+	if err != nil {
 		return err
 	}
 
-	bs.ServiceRouter.HandleFunc("/minimal/latest", func(w http.ResponseWriter, r *http.Request) {
-		value, err := bs.resolver.Resolve(context.Background(), "minimal/latest")
-		if err != nil {
-			logger.Errorw("error resolving", "err", err)
-			w.WriteHeader(http.StatusBadGateway)
-			return
-		}
-
-		w.Header().Set("Location", value)
-		w.WriteHeader(http.StatusFound)
-	})
-
-	bs.ServiceRouter.HandleFunc("/minimal/latest.zst", func(w http.ResponseWriter, r *http.Request) {
-		http.Redirect(w, r, "/minimal/latest", 301)
-		return
-	})
+	bs.configPath = configPath
+	bs.swapState(st)
 
-	return bs.dumpRoutes(bs.ServiceRouter)
+	return bs.dumpRoutes(st.router)
 }
 
-func (bs *IndexService) setupResolver(cfg *config.IndexServiceConfig) error {
-	s3ResolverCfg := cfg.S3Resolver
+func newS3Client(s3ResolverCfg config.S3ResolverConfig) (*minio.Client, error) {
 	u, err := url.Parse(s3ResolverCfg.Endpoint)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	host := u.Hostname()
@@ -112,34 +107,57 @@ func (bs *IndexService) setupResolver(cfg *config.IndexServiceConfig) error {
 
 	akBytes, err := ioutil.ReadFile(s3ResolverCfg.AccessKeyPath)
 	if err != nil {
-		return fmt.Errorf("failed to read file %s: %w", s3ResolverCfg.AccessKeyPath, err)
+		return nil, fmt.Errorf("failed to read file %s: %w", s3ResolverCfg.AccessKeyPath, err)
 	}
 	skBytes, err := ioutil.ReadFile(s3ResolverCfg.SecretKeyPath)
 	if err != nil {
-		return fmt.Errorf("failed to read file %s: %w", s3ResolverCfg.SecretKeyPath, err)
+		return nil, fmt.Errorf("failed to read file %s: %w", s3ResolverCfg.SecretKeyPath, err)
 	}
 
 	accessKey := strings.TrimSuffix(string(akBytes), "\n")
 	secretKey := strings.TrimSuffix(string(skBytes), "\n")
 
-	minioClient, err := minio.New(fmt.Sprintf("%s:%s", host, port), &minio.Options{
+	return minio.New(fmt.Sprintf("%s:%s", host, port), &minio.Options{
 		Creds:  credentials.NewStaticV4(accessKey, secretKey, ""),
 		Secure: u.Scheme == "https",
+		Region: s3ResolverCfg.Region,
 	})
-	if err != nil {
-		return err
-	}
+}
 
-	s3IndexResolver := index.NewIndexS3Resolver(minioClient, s3ResolverCfg.Bucket)
-	cachedResolver := index.NewCachedResolver(s3IndexResolver)
+// SetupOperator mounts the operator routes. Requests without a token may only call the read methods, the others
+// require the bearer token stored at tokenPath, without a token path they are refused.
+func (bs *IndexService) SetupOperator(tokenPath string) error {
+	var token []byte
+	if tokenPath != "" {
+		b, err := ioutil.ReadFile(tokenPath)
+		if err != nil {
+			return fmt.Errorf("failed to read file %s: %w", tokenPath, err)
+		}
 
-	bs.resolver = cachedResolver
+		token = []byte(strings.TrimSpace(string(b)))
+		if len(token) == 0 {
+			return fmt.Errorf("operator token %s is empty", tokenPath)
+		}
 
-	return nil
-}
+		// clients pass the token in api info, which only recognises tokens shaped like a jwt
+		if ai := cliutil.ParseApiInfo(string(token) + ":http://localhost"); len(ai.Token) == 0 {
+			return fmt.Errorf("operator token %s must be three dot separated parts of letters, digits, - and _", tokenPath)
+		}
+	}
 
-func (bs *IndexService) SetupOperator() error {
-	bs.OperatorRouter.Handle("/rpc/v0", bs.rpc)
+	var out api.OperatorStruct
+	auth.PermissionedProxy(api.AllPermissions, api.DefaultPerms, &operator.OperatorImpl{Cache: bs}, &out.Internal)
+	bs.rpc.Register("Operator", &out)
+
+	bs.OperatorRouter.Handle("/rpc/v0", &auth.Handler{
+		Verify: func(ctx context.Context, t string) ([]auth.Permission, error) {
+			if len(token) == 0 || subtle.ConstantTimeCompare([]byte(t), token) != 1 {
+				return nil, errors.New("invalid token")
+			}
+			return api.AllPermissions, nil
+		},
+		Next: bs.rpc.ServeHTTP,
+	})
 
 	bs.OperatorRouter.PathPrefix("/debug/pprof/").Handler(http.DefaultServeMux)
 
@@ -149,6 +167,9 @@ func (bs *IndexService) SetupOperator() error {
 
 	bs.OperatorRouter.HandleFunc("/readiness", func(w http.ResponseWriter, r *http.Request) {
 		isReady := bs.IsReady()
+		if bs.current().freshness.Readiness {
+			isReady = isReady && bs.freshnessReport().Fresh
+		}
 
 		if isReady {
 			w.WriteHeader(http.StatusOK)
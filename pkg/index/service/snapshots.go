@@ -0,0 +1,134 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/filecoin-project/filecoin-chain-archiver/pkg/index"
+)
+
+const (
+	defaultListLimit = 100
+	maxListLimit     = 1000
+)
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logger.Errorw("error encoding response", "err", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, format string, args ...interface{}) {
+	writeJSON(w, status, errorResponse{Error: fmt.Sprintf(format, args...)})
+}
+
+func parseSnapshotFilter(q url.Values) (index.SnapshotFilter, error) {
+	var filter index.SnapshotFilter
+
+	for name, dst := range map[string]*int64{"min_height": &filter.MinHeight, "max_height": &filter.MaxHeight} {
+		if v := q.Get(name); v != "" {
+			height, err := strconv.ParseInt(v, 10, 64)
+			if err != nil || height < 0 {
+				return filter, fmt.Errorf("invalid %s %q", name, v)
+			}
+			*dst = height
+		}
+	}
+
+	for name, dst := range map[string]*time.Time{"after": &filter.After, "before": &filter.Before} {
+		if v := q.Get(name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return filter, fmt.Errorf("invalid %s %q, expected RFC3339", name, v)
+			}
+			*dst = t
+		}
+	}
+
+	return filter, nil
+}
+
+func parsePage(q url.Values) (int, int, error) {
+	limit, offset := defaultListLimit, 0
+
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > maxListLimit {
+			return 0, 0, fmt.Errorf("invalid limit %q, must be between 1 and %d", v, maxListLimit)
+		}
+		limit = n
+	}
+
+	if v := q.Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return 0, 0, fmt.Errorf("invalid offset %q", v)
+		}
+		offset = n
+	}
+
+	return limit, offset, nil
+}
+
+// snapshotsHandler lists the snapshots under prefix, newest first.
+//
+// Query parameters:
+//
+//	limit, offset            pagination
+//	min_height, max_height   inclusive height range
+//	after, before            inclusive RFC3339 time range
+func (bs *IndexService) snapshotsHandler(lister index.Lister, prefix string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+
+		filter, err := parseSnapshotFilter(q)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "%s", err)
+			return
+		}
+
+		limit, offset, err := parsePage(q)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "%s", err)
+			return
+		}
+
+		snapshots, err := lister.List(r.Context(), prefix)
+		if err != nil {
+			logger.Errorw("error listing snapshots", "prefix", prefix, "err", err)
+			writeError(w, http.StatusBadGateway, "failed to list snapshots")
+			return
+		}
+
+		matched := index.FilterSnapshots(snapshots, filter)
+
+		list := index.SnapshotList{
+			Snapshots: []index.Snapshot{},
+			Total:     len(matched),
+			Offset:    offset,
+			Limit:     limit,
+		}
+
+		if offset < len(matched) {
+			end := offset + limit
+			if end < len(matched) {
+				list.NextOffset = &end
+			} else {
+				end = len(matched)
+			}
+			list.Snapshots = matched[offset:end]
+		}
+
+		writeJSON(w, http.StatusOK, list)
+	}
+}
@@ -0,0 +1,335 @@
+package index
+
+import (
+	"context"
+	"io"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/xerrors"
+)
+
+const (
+	SnapshotSuffix = ".car.zst"
+	ChecksumSuffix = ".sha256sum"
+	ManifestSuffix = ".json"
+
+	// SnapshotTimeFormat is the format of the time component of a snapshot name, eg: 1200_2020_08_25T22_00_00Z
+	SnapshotTimeFormat = "2006_01_02T15_04_05Z"
+)
+
+// Snapshot describes a snapshot object stored under a prefix. It is also the format of the manifest written next to
+// each snapshot.
+type Snapshot struct {
+	Name      string    `json:"name"`
+	Key       string    `json:"key"`
+	Height    int64     `json:"height"`
+	Timestamp time.Time `json:"timestamp"`
+	Size      int64     `json:"size"`
+	Digest    string    `json:"digest,omitempty"`
+	URL       string    `json:"url,omitempty"`
+}
+
+// SnapshotList is a page of snapshots, newest first, as served by the index service.
+type SnapshotList struct {
+	Snapshots  []Snapshot `json:"snapshots"`
+	Total      int        `json:"total"`
+	Offset     int        `json:"offset"`
+	Limit      int        `json:"limit"`
+	NextOffset *int       `json:"next_offset,omitempty"`
+}
+
+type Lister interface {
+	List(context.Context, string) ([]Snapshot, error)
+}
+
+// ParseSnapshotName parses the height and time from a snapshot name or filename, eg: 1200_2020_08_25T22_00_00Z.car.zst
+func ParseSnapshotName(filename string) (int64, time.Time, bool) {
+	name := strings.TrimSuffix(path.Base(filename), SnapshotSuffix)
+
+	parts := strings.SplitN(name, "_", 2)
+	if len(parts) != 2 {
+		return 0, time.Time{}, false
+	}
+
+	height, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return 0, time.Time{}, false
+	}
+
+	t, err := time.Parse(SnapshotTimeFormat, parts[1])
+	if err != nil {
+		return 0, time.Time{}, false
+	}
+
+	return height, t, true
+}
+
+// CompanionURL returns the location of an object stored next to the snapshot at location, such as its checksum.
+func CompanionURL(location, suffix string) (string, error) {
+	u, err := url.Parse(location)
+	if err != nil {
+		return "", err
+	}
+
+	if !strings.HasSuffix(u.Path, SnapshotSuffix) {
+		return "", xerrors.Errorf("location is not a snapshot: %s", location)
+	}
+
+	u.Path = strings.TrimSuffix(u.Path, SnapshotSuffix) + suffix
+	u.RawPath = ""
+
+	return u.String(), nil
+}
+
+// ParseChecksum returns the digest for filename from the contents of a sha256sum file.
+func ParseChecksum(data, filename string) (string, bool) {
+	for _, line := range strings.Split(data, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+
+		if strings.TrimPrefix(fields[1], "*") == filename {
+			return fields[0], true
+		}
+	}
+
+	return "", false
+}
+
+// SortSnapshots orders snapshots newest first.
+func SortSnapshots(snapshots []Snapshot) {
+	sort.Slice(snapshots, func(i, j int) bool {
+		if snapshots[i].Height == snapshots[j].Height {
+			return snapshots[i].Timestamp.After(snapshots[j].Timestamp)
+		}
+		return snapshots[i].Height > snapshots[j].Height
+	})
+}
+
+// SnapshotFilter selects snapshots by height and time. Zero values are not applied.
+type SnapshotFilter struct {
+	MinHeight int64
+	MaxHeight int64
+	After     time.Time
+	Before    time.Time
+}
+
+func (f SnapshotFilter) Match(s Snapshot) bool {
+	if f.MinHeight != 0 && s.Height < f.MinHeight {
+		return false
+	}
+	if f.MaxHeight != 0 && s.Height > f.MaxHeight {
+		return false
+	}
+	if !f.After.IsZero() && s.Timestamp.Before(f.After) {
+		return false
+	}
+	if !f.Before.IsZero() && s.Timestamp.After(f.Before) {
+		return false
+	}
+	return true
+}
+
+func FilterSnapshots(snapshots []Snapshot, filter SnapshotFilter) []Snapshot {
+	filtered := []Snapshot{}
+	for _, s := range snapshots {
+		if filter.Match(s) {
+			filtered = append(filtered, s)
+		}
+	}
+
+	return filtered
+}
+
+type s3ListerClientInterface interface {
+	s3ClientInterface
+	ListObjects(ctx context.Context, bucketName string, opts minio.ListObjectsOptions) <-chan minio.ObjectInfo
+}
+
+type IndexS3Lister struct {
+	client          s3ListerClientInterface
+	bucket          string
+	retrievalPrefix string
+
+	// checksums do not change once written, so they are kept while their snapshot is listed
+	digestsMu sync.Mutex
+	digests   map[string]string
+}
+
+func NewIndexS3Lister(client s3ListerClientInterface, bucket, retrievalPrefix string) *IndexS3Lister {
+	return &IndexS3Lister{
+		client:          client,
+		bucket:          bucket,
+		retrievalPrefix: retrievalPrefix,
+		digests:         make(map[string]string),
+	}
+}
+
+func (i *IndexS3Lister) List(ctx context.Context, prefix string) ([]Snapshot, error) {
+	snapshots := []Snapshot{}
+	checksums := make(map[string]string)
+
+	for object := range i.client.ListObjects(ctx, i.bucket, minio.ListObjectsOptions{Prefix: prefix}) {
+		if object.Err != nil {
+			return nil, xerrors.Errorf("failed to list snapshots: %w", object.Err)
+		}
+
+		base := path.Base(object.Key)
+		switch {
+		case strings.HasSuffix(base, ChecksumSuffix):
+			checksums[strings.TrimSuffix(base, ChecksumSuffix)] = object.Key
+		case strings.HasSuffix(base, SnapshotSuffix):
+			height, t, ok := ParseSnapshotName(base)
+			if !ok {
+				logger.Debugw("skipping object", "key", object.Key)
+				continue
+			}
+
+			s := Snapshot{
+				Name:      strings.TrimSuffix(base, SnapshotSuffix),
+				Key:       object.Key,
+				Height:    height,
+				Timestamp: t,
+				Size:      object.Size,
+			}
+
+			if i.retrievalPrefix != "" {
+				u, err := url.JoinPath(i.retrievalPrefix, object.Key)
+				if err != nil {
+					return nil, xerrors.Errorf("failed to join retrieval url: %w", err)
+				}
+				s.URL = u
+			}
+
+			snapshots = append(snapshots, s)
+		}
+	}
+
+	g, ctx := errgroup.WithContext(ctx)
+	g.SetLimit(8)
+
+	for idx := range snapshots {
+		s := &snapshots[idx]
+		key, ok := checksums[s.Name]
+		if !ok {
+			continue
+		}
+
+		g.Go(func() error {
+			digest, err := i.digest(ctx, key, path.Base(s.Key))
+			if err != nil {
+				logger.Warnw("failed to read checksum", "key", key, "err", err)
+				return nil
+			}
+			s.Digest = digest
+			return nil
+		})
+	}
+
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+
+	i.forgetDigests(prefix, checksums)
+
+	SortSnapshots(snapshots)
+
+	return snapshots, nil
+}
+
+// forgetDigests drops the digests of the checksums under prefix which are no longer listed.
+func (i *IndexS3Lister) forgetDigests(prefix string, checksums map[string]string) {
+	listed := make(map[string]bool, len(checksums))
+	for _, key := range checksums {
+		listed[key] = true
+	}
+
+	i.digestsMu.Lock()
+	defer i.digestsMu.Unlock()
+	for key := range i.digests {
+		if strings.HasPrefix(key, prefix) && !listed[key] {
+			delete(i.digests, key)
+		}
+	}
+}
+
+func (i *IndexS3Lister) digest(ctx context.Context, key, filename string) (string, error) {
+	i.digestsMu.Lock()
+	digest, ok := i.digests[key]
+	i.digestsMu.Unlock()
+	if ok {
+		return digest, nil
+	}
+
+	object, err := i.client.GetObject(ctx, i.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return "", err
+	}
+	defer object.Close()
+
+	data, err := io.ReadAll(object)
+	if err != nil {
+		return "", err
+	}
+
+	digest, ok = ParseChecksum(string(data), filename)
+	if !ok {
+		return "", xerrors.Errorf("no checksum for %s", filename)
+	}
+
+	i.digestsMu.Lock()
+	i.digests[key] = digest
+	i.digestsMu.Unlock()
+
+	return digest, nil
+}
+
+// CachedLister caches listings in the same way CachedResolver caches resolved values: concurrent listings of a
+// prefix are collapsed into one, and expired listings are served while they are listed again, or when listing fails,
+// until MaxStale runs out.
+type CachedLister struct {
+	lister Lister
+	cache  *staleCache
+}
+
+func NewCachedLister(lister Lister, opts CacheOptions) *CachedLister {
+	return &CachedLister{
+		lister: lister,
+		cache:  newStaleCache(opts),
+	}
+}
+
+func (i *CachedLister) fetchFunc(prefix string) fetchFunc {
+	return func(ctx context.Context) (interface{}, error) {
+		return i.lister.List(ctx, prefix)
+	}
+}
+
+// Invalidate removes the listing for prefix from the cache.
+func (i *CachedLister) Invalidate(prefix string) {
+	i.cache.invalidate(prefix)
+}
+
+// Flush removes every listing from the cache.
+func (i *CachedLister) Flush() {
+	i.cache.flush()
+}
+
+// List returns the cached listing for prefix. The returned slice is shared and must not be modified.
+func (i *CachedLister) List(ctx context.Context, prefix string) ([]Snapshot, error) {
+	v, err := i.cache.get(ctx, prefix, i.fetchFunc(prefix))
+	if err != nil {
+		return nil, err
+	}
+
+	return v.([]Snapshot), nil
+}
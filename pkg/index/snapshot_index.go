@@ -0,0 +1,138 @@
+package index
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrNoSnapshots is returned when the index does not hold any snapshots.
+	ErrNoSnapshots = errors.New("no snapshots available")
+	// ErrBeyondNewest is returned when the requested height or time is after the newest snapshot.
+	ErrBeyondNewest = errors.New("beyond the newest snapshot")
+	// ErrBeforeOldest is returned when the requested height or time is before the oldest snapshot.
+	ErrBeforeOldest = errors.New("before the oldest snapshot")
+)
+
+// SnapshotIndex keeps a periodically refreshed listing of the snapshots under a prefix, to look up snapshots by
+// height or time.
+type SnapshotIndex struct {
+	lister   Lister
+	prefix   string
+	interval time.Duration
+
+	mu        sync.RWMutex
+	snapshots []Snapshot
+	updated   time.Time
+}
+
+func NewSnapshotIndex(lister Lister, prefix string, interval time.Duration) *SnapshotIndex {
+	return &SnapshotIndex{
+		lister:   lister,
+		prefix:   prefix,
+		interval: interval,
+	}
+}
+
+func (si *SnapshotIndex) Refresh(ctx context.Context) error {
+	snapshots, err := si.lister.List(ctx, si.prefix)
+	if err != nil {
+		return err
+	}
+
+	sorted := append([]Snapshot(nil), snapshots...)
+	SortSnapshots(sorted)
+
+	si.mu.Lock()
+	defer si.mu.Unlock()
+	si.snapshots = sorted
+	si.updated = time.Now()
+
+	logger.Debugw("snapshot index refreshed", "prefix", si.prefix, "count", len(sorted))
+
+	return nil
+}
+
+// Run refreshes the index every interval until the context is done.
+func (si *SnapshotIndex) Run(ctx context.Context) {
+	for {
+		if err := si.Refresh(ctx); err != nil {
+			logger.Errorw("error refreshing snapshot index", "prefix", si.prefix, "err", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(si.interval):
+		}
+	}
+}
+
+// Snapshots returns the indexed snapshots, newest first.
+func (si *SnapshotIndex) Snapshots() []Snapshot {
+	si.mu.RLock()
+	defer si.mu.RUnlock()
+	return si.snapshots
+}
+
+// Newest returns the most recent snapshot.
+func (si *SnapshotIndex) Newest() (Snapshot, error) {
+	si.mu.RLock()
+	defer si.mu.RUnlock()
+	if len(si.snapshots) == 0 {
+		return Snapshot{}, ErrNoSnapshots
+	}
+
+	return si.snapshots[0], nil
+}
+
+// AtHeight returns the snapshot at or just before height.
+func (si *SnapshotIndex) AtHeight(height int64) (Snapshot, error) {
+	return si.find(func(s Snapshot) int {
+		switch {
+		case s.Height < height:
+			return -1
+		case s.Height > height:
+			return 1
+		}
+		return 0
+	})
+}
+
+// AtTime returns the snapshot at or just before t.
+func (si *SnapshotIndex) AtTime(t time.Time) (Snapshot, error) {
+	return si.find(func(s Snapshot) int {
+		switch {
+		case s.Timestamp.Before(t):
+			return -1
+		case s.Timestamp.After(t):
+			return 1
+		}
+		return 0
+	})
+}
+
+// find returns the newest snapshot which is not after the target. compare reports if a snapshot is before (-1), at
+// (0) or after (1) the target.
+func (si *SnapshotIndex) find(compare func(Snapshot) int) (Snapshot, error) {
+	si.mu.RLock()
+	defer si.mu.RUnlock()
+
+	if len(si.snapshots) == 0 {
+		return Snapshot{}, ErrNoSnapshots
+	}
+
+	if compare(si.snapshots[0]) < 0 {
+		return Snapshot{}, ErrBeyondNewest
+	}
+
+	for _, s := range si.snapshots {
+		if compare(s) <= 0 {
+			return s, nil
+		}
+	}
+
+	return Snapshot{}, ErrBeforeOldest
+}
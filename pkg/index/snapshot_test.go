@@ -0,0 +1,179 @@
+package index
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSnapshotName(t *testing.T) {
+	height, ts, ok := ParseSnapshotName("minimal/1200_2020_08_25T22_00_00Z.car.zst")
+	assert.True(t, ok)
+	assert.Equal(t, int64(1200), height)
+	assert.Equal(t, time.Date(2020, 8, 25, 22, 0, 0, 0, time.UTC), ts)
+
+	height, _, ok = ParseSnapshotName("1200_2020_08_25T22_00_00Z")
+	assert.True(t, ok)
+	assert.Equal(t, int64(1200), height)
+
+	_, _, ok = ParseSnapshotName("latest")
+	assert.False(t, ok)
+
+	_, _, ok = ParseSnapshotName("1200_yesterday.car.zst")
+	assert.False(t, ok)
+}
+
+func TestParseChecksum(t *testing.T) {
+	data := "abc123 *1200_2020_08_25T22_00_00Z.car.zst\ndef456 *1200_2020_08_25T22_00_00Z.car\n"
+
+	digest, ok := ParseChecksum(data, "1200_2020_08_25T22_00_00Z.car.zst")
+	assert.True(t, ok)
+	assert.Equal(t, "abc123", digest)
+
+	_, ok = ParseChecksum(data, "other.car.zst")
+	assert.False(t, ok)
+}
+
+func TestFilterSnapshots(t *testing.T) {
+	base := time.Date(2020, 8, 25, 0, 0, 0, 0, time.UTC)
+	snapshots := []Snapshot{
+		{Height: 100, Timestamp: base},
+		{Height: 300, Timestamp: base.Add(2 * time.Hour)},
+		{Height: 200, Timestamp: base.Add(time.Hour)},
+	}
+
+	SortSnapshots(snapshots)
+	assert.Equal(t, int64(300), snapshots[0].Height)
+	assert.Equal(t, int64(100), snapshots[2].Height)
+
+	assert.Len(t, FilterSnapshots(snapshots, SnapshotFilter{}), 3)
+	assert.Len(t, FilterSnapshots(snapshots, SnapshotFilter{MinHeight: 200}), 2)
+	assert.Len(t, FilterSnapshots(snapshots, SnapshotFilter{MinHeight: 150, MaxHeight: 250}), 1)
+	assert.Len(t, FilterSnapshots(snapshots, SnapshotFilter{After: base.Add(time.Hour)}), 2)
+	assert.Len(t, FilterSnapshots(snapshots, SnapshotFilter{Before: base.Add(30 * time.Minute)}), 1)
+}
+
+type staticLister []Snapshot
+
+func (l staticLister) List(ctx context.Context, prefix string) ([]Snapshot, error) {
+	return l, nil
+}
+
+func TestSnapshotIndex(t *testing.T) {
+	base := time.Date(2020, 8, 25, 0, 0, 0, 0, time.UTC)
+	si := NewSnapshotIndex(staticLister{
+		{Height: 100, Timestamp: base},
+		{Height: 300, Timestamp: base.Add(2 * time.Hour)},
+		{Height: 200, Timestamp: base.Add(time.Hour)},
+	}, "minimal/", time.Minute)
+
+	_, err := si.AtHeight(100)
+	assert.ErrorIs(t, err, ErrNoSnapshots)
+
+	require.NoError(t, si.Refresh(context.Background()))
+
+	s, err := si.AtHeight(200)
+	require.NoError(t, err)
+	assert.Equal(t, int64(200), s.Height)
+
+	s, err = si.AtHeight(299)
+	require.NoError(t, err)
+	assert.Equal(t, int64(200), s.Height)
+
+	s, err = si.AtHeight(300)
+	require.NoError(t, err)
+	assert.Equal(t, int64(300), s.Height)
+
+	_, err = si.AtHeight(301)
+	assert.ErrorIs(t, err, ErrBeyondNewest)
+
+	_, err = si.AtHeight(99)
+	assert.ErrorIs(t, err, ErrBeforeOldest)
+
+	s, err = si.AtTime(base.Add(90 * time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, int64(200), s.Height)
+}
+
+func TestCompanionURL(t *testing.T) {
+	u, err := CompanionURL("https://example.com/minimal/1200_2020_08_25T22_00_00Z.car.zst", ChecksumSuffix)
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com/minimal/1200_2020_08_25T22_00_00Z.sha256sum", u)
+
+	u, err = CompanionURL("https://example.com/minimal/1200_2020_08_25T22_00_00Z.car.zst", ManifestSuffix)
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com/minimal/1200_2020_08_25T22_00_00Z.json", u)
+
+	_, err = CompanionURL("https://example.com/minimal/latest", ChecksumSuffix)
+	assert.Error(t, err)
+}
+
+type countingLister struct {
+	calls int32
+	delay time.Duration
+	err   error
+	errMu sync.Mutex
+}
+
+func (l *countingLister) setErr(err error) {
+	l.errMu.Lock()
+	defer l.errMu.Unlock()
+	l.err = err
+}
+
+func (l *countingLister) List(ctx context.Context, prefix string) ([]Snapshot, error) {
+	n := atomic.AddInt32(&l.calls, 1)
+	time.Sleep(l.delay)
+
+	l.errMu.Lock()
+	defer l.errMu.Unlock()
+	if l.err != nil {
+		return nil, l.err
+	}
+
+	return []Snapshot{{Name: prefix, Height: int64(n)}}, nil
+}
+
+func TestCachedLister(t *testing.T) {
+	backend := &countingLister{delay: 20 * time.Millisecond}
+	cl := NewCachedLister(backend, CacheOptions{TTL: 50 * time.Millisecond, MaxStale: time.Minute})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			snapshots, err := cl.List(context.Background(), "minimal/")
+			assert.NoError(t, err)
+			assert.Equal(t, int64(1), snapshots[0].Height)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&backend.calls))
+
+	// expired listings are kept when listing fails
+	backend.setErr(errors.New("unavailable"))
+	time.Sleep(60 * time.Millisecond)
+
+	snapshots, err := cl.List(context.Background(), "minimal/")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), snapshots[0].Height)
+
+	backend.setErr(nil)
+	require.Eventually(t, func() bool {
+		snapshots, err := cl.List(context.Background(), "minimal/")
+		return err == nil && snapshots[0].Height > 2
+	}, time.Second, 10*time.Millisecond)
+
+	cl.Invalidate("minimal/")
+	calls := atomic.LoadInt32(&backend.calls)
+	snapshots, err = cl.List(context.Background(), "minimal/")
+	require.NoError(t, err)
+	assert.Equal(t, int64(calls+1), snapshots[0].Height)
+}
@@ -0,0 +1,142 @@
+package job
+
+import (
+	"sync"
+	"time"
+
+	"github.com/filecoin-project/go-state-types/abi"
+
+	"github.com/filecoin-project/filecoin-chain-archiver/pkg/export"
+)
+
+// PhaseScheduled is reported before the export has started, while the job waits for the snapshot height.
+const PhaseScheduled export.Phase = "scheduled"
+
+type Lock interface {
+	Expiry() time.Time
+}
+
+// Job tracks the state of a single snapshot job so it can be reported while the job is running.
+type Job struct {
+	mu sync.Mutex
+
+	height       abi.ChainEpoch
+	peerID       string
+	export       *export.Export
+	lock         Lock
+	previousSize int64
+	compressed   int64
+	started      time.Time
+}
+
+type Report struct {
+	Height               abi.ChainEpoch `json:"height"`
+	PeerID               string         `json:"peer_id,omitempty"`
+	Phase                export.Phase   `json:"phase"`
+	Started              time.Time      `json:"started"`
+	PhaseStarted         *time.Time     `json:"phase_started,omitempty"`
+	Error                string         `json:"error,omitempty"`
+	BytesExported        int            `json:"bytes_exported"`
+	BytesCompressed      int64          `json:"bytes_compressed"`
+	Throughput           float64        `json:"throughput"`
+	CompressionRatio     float64        `json:"compression_ratio,omitempty"`
+	PreviousSnapshotSize int64          `json:"previous_snapshot_size,omitempty"`
+	EstimatedCompletion  *time.Time     `json:"estimated_completion,omitempty"`
+	LockExpiry           *time.Time     `json:"lock_expiry,omitempty"`
+}
+
+func NewJob() *Job {
+	return &Job{
+		started: time.Now(),
+	}
+}
+
+func (j *Job) SetHeight(height abi.ChainEpoch) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.height = height
+}
+
+func (j *Job) SetPeer(peerID string, lock Lock) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.peerID = peerID
+	j.lock = lock
+}
+
+func (j *Job) SetExport(e *export.Export) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.export = e
+}
+
+// SetPreviousSize records the compressed size of the previous snapshot, which is used to estimate completion.
+func (j *Job) SetPreviousSize(size int64) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.previousSize = size
+}
+
+// AddCompressed records compressed bytes written for upload.
+func (j *Job) AddCompressed(n int) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.compressed += int64(n)
+}
+
+func (j *Job) Export() *export.Export {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.export
+}
+
+func (j *Job) Report() Report {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	report := Report{
+		Height:               j.height,
+		PeerID:               j.peerID,
+		Phase:                PhaseScheduled,
+		Started:              j.started,
+		BytesCompressed:      j.compressed,
+		PreviousSnapshotSize: j.previousSize,
+	}
+
+	if j.lock != nil {
+		expiry := j.lock.Expiry()
+		report.LockExpiry = &expiry
+	}
+
+	if j.export == nil {
+		return report
+	}
+
+	status := j.export.Status()
+	report.Phase = status.Phase
+	report.Error = status.Error
+	report.BytesExported = status.Bytes
+	if j.compressed > 0 && status.Bytes > 0 {
+		report.CompressionRatio = float64(status.Bytes) / float64(j.compressed)
+	}
+	if !status.PhaseStarted.IsZero() {
+		report.PhaseStarted = &status.PhaseStarted
+	}
+
+	exporting := status.PhaseDuration(export.PhaseExporting).Seconds()
+	if exporting <= 0 {
+		return report
+	}
+
+	report.Throughput = float64(status.Bytes) / exporting
+
+	// the previous snapshot is compressed, so completion is estimated from the compressed bytes
+	if status.Phase == export.PhaseExporting && j.previousSize > j.compressed && j.compressed > 0 {
+		rate := float64(j.compressed) / exporting
+		remaining := time.Duration(float64(j.previousSize-j.compressed) / rate * float64(time.Second))
+		eta := time.Now().Add(remaining)
+		report.EstimatedCompletion = &eta
+	}
+
+	return report
+}
@@ -0,0 +1,167 @@
+package job
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+
+	"github.com/filecoin-project/go-state-types/abi"
+
+	"github.com/filecoin-project/filecoin-chain-archiver/pkg/export"
+)
+
+const (
+	metricsNamespace = "fca"
+	metricsSubsystem = "snapshot"
+)
+
+// Registry holds the snapshot job metrics. It is kept separate from the default registry so that only job metrics
+// are sent to a pushgateway.
+var Registry = prometheus.NewRegistry()
+
+// The metrics describe a single job, a process runs one job and the pushgateway replaces the metrics of a group with
+// those of the last job pushed to it. They do not accumulate over jobs.
+var (
+	JobFinishedTimestamp = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Subsystem: metricsSubsystem,
+		Name:      "job_finished_timestamp_seconds",
+		Help:      "Unix time the snapshot job finished",
+	})
+
+	JobSucceeded = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Subsystem: metricsSubsystem,
+		Name:      "job_succeeded",
+		Help:      "1 when the snapshot job succeeded, 0 when it failed",
+	})
+
+	ExportBytes = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Subsystem: metricsSubsystem,
+		Name:      "export_bytes",
+		Help:      "Number of uncompressed bytes received from the chain export of the job",
+	})
+
+	CompressionRatio = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Subsystem: metricsSubsystem,
+		Name:      "compression_ratio",
+		Help:      "Ratio of uncompressed to compressed snapshot size",
+		Buckets:   prometheus.LinearBuckets(1, 0.5, 10),
+	})
+
+	Throughput = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Subsystem: metricsSubsystem,
+		Name:      "throughput_bytes_per_second",
+		Help:      "Uncompressed bytes exported and compressed per second while exporting",
+		Buckets:   prometheus.ExponentialBuckets(1<<20, 2, 10),
+	})
+
+	UploadDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Subsystem: metricsSubsystem,
+		Name:      "upload_duration_seconds",
+		Help:      "Time taken to upload a snapshot",
+		Buckets:   prometheus.ExponentialBuckets(60, 2, 10),
+	})
+
+	RestartWaitDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Subsystem: metricsSubsystem,
+		Name:      "restart_wait_duration_seconds",
+		Help:      "Time spent waiting for the node to restart before exporting",
+		Buckets:   prometheus.ExponentialBuckets(5, 2, 8),
+	})
+
+	// The published gauges are vectors so that they are only reported once set. A failed job pushing to a
+	// pushgateway does not overwrite the values from the last successful job.
+	LastPublishedTimestamp = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Subsystem: metricsSubsystem,
+		Name:      "last_published_timestamp_seconds",
+		Help:      "Unix time of the chain height of the last published snapshot",
+	}, []string{"prefix"})
+
+	LastPublishedHeight = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Subsystem: metricsSubsystem,
+		Name:      "last_published_height",
+		Help:      "Chain height of the last published snapshot",
+	}, []string{"prefix"})
+)
+
+func init() {
+	Registry.MustRegister(
+		JobFinishedTimestamp,
+		JobSucceeded,
+		ExportBytes,
+		CompressionRatio,
+		Throughput,
+		UploadDuration,
+		RestartWaitDuration,
+		LastPublishedTimestamp,
+		LastPublishedHeight,
+	)
+}
+
+// Result is the result label of a job which finished with err, either success or failure.
+func Result(err error) string {
+	if err != nil {
+		return "failure"
+	}
+	return "success"
+}
+
+// Finish records the outcome of the job.
+func (j *Job) Finish(err error) {
+	JobFinishedTimestamp.SetToCurrentTime()
+	if err == nil {
+		JobSucceeded.Set(1)
+	} else {
+		JobSucceeded.Set(0)
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.export == nil {
+		return
+	}
+
+	status := j.export.Status()
+	ExportBytes.Set(float64(status.Bytes))
+
+	restart := status.PhaseDuration(export.PhaseShuttingDown) + status.PhaseDuration(export.PhaseWaitingOffline) + status.PhaseDuration(export.PhaseWaitingOnline)
+	if restart > 0 {
+		RestartWaitDuration.Observe(restart.Seconds())
+	}
+
+	if err == nil && j.compressed > 0 && status.Bytes > 0 {
+		CompressionRatio.Observe(float64(status.Bytes) / float64(j.compressed))
+	}
+
+	if exporting := status.PhaseDuration(export.PhaseExporting); err == nil && exporting > 0 {
+		Throughput.Observe(float64(status.Bytes) / exporting.Seconds())
+	}
+}
+
+// Published records that a snapshot was made available under the given name prefix.
+func Published(prefix string, height abi.ChainEpoch, at time.Time) {
+	LastPublishedHeight.WithLabelValues(prefix).Set(float64(height))
+	LastPublishedTimestamp.WithLabelValues(prefix).Set(float64(at.Unix()))
+}
+
+// Push sends the job metrics to a pushgateway. The pushgateway replaces the metrics of the group with those pushed, so
+// callers group by Result to keep the metrics of the last successful job when a job fails.
+func Push(ctx context.Context, url, jobName string, grouping map[string]string) error {
+	pusher := push.New(url, jobName).Gatherer(Registry)
+	for k, v := range grouping {
+		pusher = pusher.Grouping(k, v)
+	}
+
+	return pusher.AddContext(ctx)
+}
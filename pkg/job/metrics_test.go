@@ -0,0 +1,59 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPush(t *testing.T) {
+	type request struct {
+		method string
+		path   string
+		names  []string
+	}
+
+	requests := make(chan request, 1)
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := request{method: r.Method, path: r.URL.Path}
+
+		dec := expfmt.NewDecoder(r.Body, expfmt.ResponseFormat(r.Header))
+		for {
+			var mf dto.MetricFamily
+			if err := dec.Decode(&mf); err != nil {
+				if !errors.Is(err, io.EOF) {
+					t.Errorf("decoding metrics: %s", err)
+				}
+				break
+			}
+			req.names = append(req.names, mf.GetName())
+		}
+
+		requests <- req
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer gateway.Close()
+
+	j := NewJob()
+	j.SetHeight(1200)
+	j.Finish(nil)
+	Published("minimal", 1200, time.Unix(1600000000, 0))
+
+	require.NoError(t, Push(context.Background(), gateway.URL, "filecoin-chain-archiver", map[string]string{"instance": "minimal", "result": Result(nil)}))
+
+	req := <-requests
+	assert.Equal(t, http.MethodPost, req.method)
+	assert.Equal(t, "/metrics/job/filecoin-chain-archiver/instance/minimal/result/success", req.path)
+	assert.Contains(t, req.names, "fca_snapshot_job_finished_timestamp_seconds")
+	assert.Contains(t, req.names, "fca_snapshot_last_published_height")
+	assert.NotContains(t, req.names, "go_goroutines")
+}
@@ -0,0 +1,102 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/mux"
+	"github.com/ipfs/go-log/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/filecoin-project/filecoin-chain-archiver/pkg/export"
+	"github.com/filecoin-project/filecoin-chain-archiver/pkg/job"
+)
+
+var logger = log.Logger("filecoin-chain-archiver/service/job-status")
+
+// JobStatusService serves the status of a running snapshot job.
+type JobStatusService struct {
+	ctx    context.Context
+	Router *mux.Router
+
+	ready   bool
+	readyMu sync.Mutex
+
+	job *job.Job
+}
+
+func NewJobStatusService(ctx context.Context, j *job.Job) *JobStatusService {
+	return &JobStatusService{
+		ctx:    ctx,
+		Router: mux.NewRouter(),
+		job:    j,
+	}
+}
+
+func (bs *JobStatusService) SetupService() error {
+	defer bs.setReady()
+
+	bs.Router.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(bs.job.Report()); err != nil {
+			logger.Errorw("error encoding status", "err", err)
+		}
+	}).Methods(http.MethodGet)
+
+	bs.Router.HandleFunc("/liveness", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	bs.Router.HandleFunc("/readiness", func(w http.ResponseWriter, r *http.Request) {
+		if bs.IsReady() {
+			w.WriteHeader(http.StatusOK)
+		} else {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	})
+
+	bs.Router.Handle("/metrics", promhttp.HandlerFor(prometheus.Gatherers{prometheus.DefaultGatherer, job.Registry}, promhttp.HandlerOpts{}))
+
+	return bs.dumpRoutes(bs.Router)
+}
+
+func (bs *JobStatusService) dumpRoutes(router *mux.Router) error {
+	return router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		pathTemplate, err := route.GetPathTemplate()
+		if err == nil {
+			logger.Debugw("route template", "path", pathTemplate)
+		}
+		methods, err := route.GetMethods()
+		if err == nil {
+			logger.Debugw("method", "queries", strings.Join(methods, ","))
+		}
+		return nil
+	})
+}
+
+func (bs *JobStatusService) setReady() {
+	bs.readyMu.Lock()
+	defer bs.readyMu.Unlock()
+	bs.ready = true
+}
+
+// IsReady reports if the service is running and the job has not failed.
+func (bs *JobStatusService) IsReady() bool {
+	bs.readyMu.Lock()
+	defer bs.readyMu.Unlock()
+	return bs.ready && bs.job.Report().Phase != export.PhaseFailed
+}
+
+func (bs *JobStatusService) Shutdown() {
+	bs.unsetReady()
+}
+
+func (bs *JobStatusService) unsetReady() {
+	bs.readyMu.Lock()
+	defer bs.readyMu.Unlock()
+	bs.ready = false
+}
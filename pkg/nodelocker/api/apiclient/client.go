@@ -8,7 +8,7 @@ import (
 	"github.com/filecoin-project/go-jsonrpc"
 )
 
-func NewOperatorClient(ctx context.Context, addr string, requestHeader http.Header) (api.Operator, jsonrpc.ClientCloser, error) {
+func NewOperatorClient(ctx context.Context, addr string, requestHeader http.Header, opts ...jsonrpc.Option) (api.Operator, jsonrpc.ClientCloser, error) {
 	var res api.OperatorStruct
 	closer, err := jsonrpc.NewMergeClient(ctx, addr, "Operator",
 		[]interface{}{
@@ -16,18 +16,20 @@ func NewOperatorClient(ctx context.Context, addr string, requestHeader http.Head
 			&res.NodeLockerStruct.Internal,
 		},
 		requestHeader,
+		opts...,
 	)
 
 	return &res, closer, err
 }
 
-func NewServiceClient(ctx context.Context, addr string, requestHeader http.Header) (api.NodeLocker, jsonrpc.ClientCloser, error) {
+func NewServiceClient(ctx context.Context, addr string, requestHeader http.Header, opts ...jsonrpc.Option) (api.NodeLocker, jsonrpc.ClientCloser, error) {
 	var res api.NodeLockerStruct
 	closer, err := jsonrpc.NewMergeClient(ctx, addr, "NodeLocker",
 		[]interface{}{
 			&res.Internal,
 		},
 		requestHeader,
+		opts...,
 	)
 
 	return &res, closer, err
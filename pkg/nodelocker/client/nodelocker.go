@@ -3,10 +3,12 @@ package client
 import (
 	"context"
 	"math/rand"
+	"sync"
 	"time"
 
 	"github.com/filecoin-project/filecoin-chain-archiver/pkg/nodelocker"
 	"github.com/filecoin-project/filecoin-chain-archiver/pkg/nodelocker/api/apiclient"
+	"github.com/filecoin-project/filecoin-chain-archiver/pkg/tlsutil"
 	cliutil "github.com/filecoin-project/lotus/cli/util"
 )
 
@@ -35,7 +37,9 @@ type NodeLock struct {
 	conn   NodeLockerConn
 	peerID string
 	secret string
-	expiry time.Time
+
+	expiryMu sync.Mutex
+	expiry   time.Time
 }
 
 func (nl *NodeLock) Renew(ctx context.Context) (bool, error) {
@@ -44,23 +48,51 @@ func (nl *NodeLock) Renew(ctx context.Context) (bool, error) {
 		return false, err
 	}
 
+	nl.expiryMu.Lock()
+	defer nl.expiryMu.Unlock()
 	nl.expiry = lock.Expiry
 
 	return lock.Acquired, nil
 }
 
 func (nl *NodeLock) Expiry() time.Time {
+	nl.expiryMu.Lock()
+	defer nl.expiryMu.Unlock()
 	return nl.expiry
 }
 
-func NewNodeLocker(ctx context.Context, endpoint string) (*NodeLocker, error) {
+type options struct {
+	tls tlsutil.ClientConfig
+}
+
+type Option func(*options)
+
+// WithTLS sets the certificates used to connect to the service. The endpoint must be an https URL, eg:
+// https://nodelocker.example.com:5100
+func WithTLS(cfg tlsutil.ClientConfig) Option {
+	return func(o *options) {
+		o.tls = cfg
+	}
+}
+
+func NewNodeLocker(ctx context.Context, endpoint string, opts ...Option) (*NodeLocker, error) {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+
 	ai := cliutil.ParseApiInfo(endpoint)
 	url, err := ai.DialArgs("v0")
 	if err != nil {
 		return nil, err
 	}
 
-	conn, closer, err := apiclient.NewServiceClient(ctx, url, ai.AuthHeader())
+	rpcOpts, err := tlsutil.JSONRPCOptions(url, o.tls)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, closer, err := apiclient.NewServiceClient(ctx, url, ai.AuthHeader(), rpcOpts...)
 	if err != nil {
 		return nil, err
 	}
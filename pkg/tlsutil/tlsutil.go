@@ -0,0 +1,192 @@
+// Package tlsutil configures TLS for the service listeners and their clients.
+package tlsutil
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+
+	"github.com/filecoin-project/go-jsonrpc"
+	"github.com/ipfs/go-log/v2"
+)
+
+var logger = log.Logger("filecoin-chain-archiver/pkg/tlsutil")
+
+// ServerConfig describes the TLS of a listener. Listeners serve plain http when CertPath is empty.
+type ServerConfig struct {
+	CertPath string
+	KeyPath  string
+	// ClientCAPath requires clients to present a certificate signed by one of the CAs in the file
+	ClientCAPath string
+}
+
+func (c ServerConfig) Enabled() bool {
+	return c.CertPath != ""
+}
+
+// Server holds the certificates of a listener, which can be reloaded while it is serving.
+type Server struct {
+	cfg ServerConfig
+
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+}
+
+func NewServer(cfg ServerConfig) (*Server, error) {
+	if cfg.CertPath == "" || cfg.KeyPath == "" {
+		return nil, fmt.Errorf("both a certificate and key are required")
+	}
+
+	s := &Server{cfg: cfg}
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Reload reads the certificates again. The previous certificates are kept when they can not be read.
+func (s *Server) Reload() error {
+	cert, err := tls.LoadX509KeyPair(s.cfg.CertPath, s.cfg.KeyPath)
+	if err != nil {
+		return fmt.Errorf("failed to load certificate: %w", err)
+	}
+
+	var clientCAs *x509.CertPool
+	if s.cfg.ClientCAPath != "" {
+		clientCAs, err = loadCertPool(s.cfg.ClientCAPath)
+		if err != nil {
+			return err
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cert = &cert
+	s.clientCAs = clientCAs
+
+	logger.Infow("loaded certificates", "cert", s.cfg.CertPath, "client_ca", s.cfg.ClientCAPath)
+
+	return nil
+}
+
+// TLSConfig returns a config which always uses the most recently loaded certificates.
+func (s *Server) TLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			s.mu.RLock()
+			defer s.mu.RUnlock()
+
+			cfg := &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*s.cert},
+			}
+
+			if s.clientCAs != nil {
+				cfg.ClientCAs = s.clientCAs
+				cfg.ClientAuth = tls.RequireAndVerifyClientCert
+			}
+
+			return cfg, nil
+		},
+	}
+}
+
+// ListenAndServe serves svr over TLS when s is set, and plain http otherwise.
+func ListenAndServe(svr *http.Server, s *Server) error {
+	if s == nil {
+		return svr.ListenAndServe()
+	}
+
+	svr.TLSConfig = s.TLSConfig()
+	return svr.ListenAndServeTLS("", "")
+}
+
+// ClientConfig describes the TLS of a client. All fields are optional, the system roots are used when CAPath is
+// empty.
+type ClientConfig struct {
+	CAPath string
+	// CertPath and KeyPath are the certificate presented to servers which verify clients
+	CertPath string
+	KeyPath  string
+}
+
+func (c ClientConfig) Enabled() bool {
+	return c.CAPath != "" || c.CertPath != "" || c.KeyPath != ""
+}
+
+// TLSConfig returns the client config, or nil when no options are set.
+func (c ClientConfig) TLSConfig() (*tls.Config, error) {
+	if !c.Enabled() {
+		return nil, nil
+	}
+
+	cfg := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if c.CAPath != "" {
+		pool, err := loadCertPool(c.CAPath)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RootCAs = pool
+	}
+
+	if c.CertPath != "" || c.KeyPath != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertPath, c.KeyPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return cfg, nil
+}
+
+// JSONRPCOptions returns the options of a jsonrpc client of addr using cfg. The websocket client of go-jsonrpc can
+// not be given a TLS config, so addr must be an http or https URL when any option is set.
+func JSONRPCOptions(addr string, cfg ClientConfig) ([]jsonrpc.Option, error) {
+	tlsCfg, err := cfg.TLSConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	if tlsCfg == nil {
+		return nil, nil
+	}
+
+	u, err := url.Parse(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.Scheme != "https" {
+		return nil, fmt.Errorf("tls options require an https endpoint, got %s", addr)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsCfg
+
+	return []jsonrpc.Option{jsonrpc.WithHTTPClient(&http.Client{Transport: transport})}, nil
+}
+
+func loadCertPool(p string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file %s: %w", p, err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates found in %s", p)
+	}
+
+	return pool, nil
+}
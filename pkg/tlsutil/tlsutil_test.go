@@ -0,0 +1,146 @@
+package tlsutil
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCert(t *testing.T, name string, serial int64, parent *testCert) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+
+	signer := &testCert{cert: tmpl, key: key}
+	if parent == nil {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+		tmpl.KeyUsage |= x509.KeyUsageCertSign
+	} else {
+		signer = parent
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer.cert, &key.PublicKey, signer.key)
+	require.NoError(t, err)
+
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return &testCert{cert: cert, key: key}
+}
+
+// write stores the certificate and key under dir, returning their paths
+func (c *testCert) write(t *testing.T, dir, name string) (string, string) {
+	certPath := filepath.Join(dir, name+".crt")
+	keyPath := filepath.Join(dir, name+".key")
+
+	require.NoError(t, os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.cert.Raw}), 0600))
+
+	der, err := x509.MarshalECPrivateKey(c.key)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0600))
+
+	return certPath, keyPath
+}
+
+func TestServer(t *testing.T) {
+	dir := t.TempDir()
+
+	ca := newTestCert(t, "ca", 1, nil)
+	caPath, _ := ca.write(t, dir, "ca")
+	serverCertPath, serverKeyPath := newTestCert(t, "server", 2, ca).write(t, dir, "server")
+	clientCertPath, clientKeyPath := newTestCert(t, "client", 3, ca).write(t, dir, "client")
+
+	s, err := NewServer(ServerConfig{
+		CertPath:     serverCertPath,
+		KeyPath:      serverKeyPath,
+		ClientCAPath: caPath,
+	})
+	require.NoError(t, err)
+
+	svr := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	svr.TLS = s.TLSConfig()
+	svr.StartTLS()
+	defer svr.Close()
+
+	get := func(cfg ClientConfig) (*x509.Certificate, error) {
+		tlsCfg, err := cfg.TLSConfig()
+		require.NoError(t, err)
+
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsCfg}}
+		resp, err := client.Get(svr.URL)
+		if err != nil {
+			return nil, err
+		}
+		resp.Body.Close()
+
+		return resp.TLS.PeerCertificates[0], nil
+	}
+
+	cert, err := get(ClientConfig{CAPath: caPath, CertPath: clientCertPath, KeyPath: clientKeyPath})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), cert.SerialNumber.Int64())
+
+	_, err = get(ClientConfig{CAPath: caPath})
+	assert.Error(t, err, "clients without a certificate are rejected")
+
+	// certificates replaced on disk are served once reloaded
+	newTestCert(t, "server", 4, ca).write(t, dir, "server")
+	require.NoError(t, s.Reload())
+
+	cert, err = get(ClientConfig{CAPath: caPath, CertPath: clientCertPath, KeyPath: clientKeyPath})
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), cert.SerialNumber.Int64())
+
+	// a failed reload keeps the previous certificates
+	require.NoError(t, os.WriteFile(serverKeyPath, []byte("invalid"), 0600))
+	assert.Error(t, s.Reload())
+
+	cert, err = get(ClientConfig{CAPath: caPath, CertPath: clientCertPath, KeyPath: clientKeyPath})
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), cert.SerialNumber.Int64())
+}
+
+func TestJSONRPCOptions(t *testing.T) {
+	opts, err := JSONRPCOptions("ws://localhost:5100/rpc/v0", ClientConfig{})
+	require.NoError(t, err)
+	assert.Empty(t, opts)
+
+	dir := t.TempDir()
+	caPath, _ := newTestCert(t, "ca", 1, nil).write(t, dir, "ca")
+
+	opts, err = JSONRPCOptions("https://localhost:5100/rpc/v0", ClientConfig{CAPath: caPath})
+	require.NoError(t, err)
+	assert.Len(t, opts, 1)
+
+	_, err = JSONRPCOptions("ws://localhost:5100/rpc/v0", ClientConfig{CAPath: caPath})
+	assert.Error(t, err, "the websocket client can not be configured")
+}